@@ -0,0 +1,296 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Keys used by the binary event encodings
+const (
+	binaryTimeKey   = "time"
+	binaryLevelKey  = "level"
+	binaryNameKey   = "name"
+	binaryMsgKey    = "msg"
+	binaryErrorKey  = "error"
+	binaryFieldsKey = "fields"
+	binaryFramesKey = "frames"
+)
+
+// maxBinaryDepth limits how deeply nested decoded values may be.
+const maxBinaryDepth = 32
+
+var (
+	errBinaryTruncated = errors.New("billet/format: truncated encoded event")
+	errBinaryDepth     = errors.New("billet/format: encoded event is nested too deeply")
+)
+
+// binaryEncoder writes the primitives shared by the MessagePack and CBOR
+// event encodings.
+type binaryEncoder interface {
+	writeMap(buffer Buffer, n int)
+	writeArray(buffer Buffer, n int)
+	writeString(buffer Buffer, s string)
+	writeInt(buffer Buffer, i int64)
+	writeUint(buffer Buffer, u uint64)
+	writeFloat32(buffer Buffer, f float32)
+	writeFloat64(buffer Buffer, f float64)
+	writeBool(buffer Buffer, b bool)
+	writeNil(buffer Buffer)
+	writeTime(buffer Buffer, t time.Time)
+}
+
+// writeBinaryEvent encodes the event as a map.  The time, level, and
+// message are always present.  The name, error, fields, and frames are only
+// written when set.  Frames are encoded as [package, function, file, line]
+// arrays.
+func writeBinaryEvent(enc binaryEncoder, buffer Buffer, event *Event) {
+	name := event.Context.Name()
+	numFields := event.Context.NumFields()
+	size := 3
+	if name != "" {
+		size++
+	}
+	if event.Error != nil {
+		size++
+	}
+	if numFields > 0 {
+		size++
+	}
+	if event.HasFrames() {
+		size++
+	}
+
+	enc.writeMap(buffer, size)
+	enc.writeString(buffer, binaryTimeKey)
+	enc.writeTime(buffer, event.Time)
+	enc.writeString(buffer, binaryLevelKey)
+	enc.writeUint(buffer, uint64(event.Level))
+	if name != "" {
+		enc.writeString(buffer, binaryNameKey)
+		enc.writeString(buffer, name)
+	}
+	enc.writeString(buffer, binaryMsgKey)
+	enc.writeString(buffer, event.Message)
+	if event.Error != nil {
+		enc.writeString(buffer, binaryErrorKey)
+		enc.writeString(buffer, event.Error.Error())
+	}
+	if numFields > 0 {
+		enc.writeString(buffer, binaryFieldsKey)
+		writeBinaryValue(enc, buffer, event.Context.Fields())
+	}
+	if event.HasFrames() {
+		stack := event.Stack()
+		enc.writeString(buffer, binaryFramesKey)
+		enc.writeArray(buffer, len(stack))
+		for _, frame := range stack {
+			enc.writeArray(buffer, 4)
+			enc.writeString(buffer, frame.Package())
+			enc.writeString(buffer, frame.Function())
+			enc.writeString(buffer, frame.File())
+			enc.writeUint(buffer, uint64(frame.Line()))
+		}
+	}
+}
+
+// writeBinaryValue encodes a context value with its native type.  Durations
+// are encoded as integer nanoseconds and byte sizes as unsigned integers.
+func writeBinaryValue(enc binaryEncoder, buffer Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		enc.writeNil(buffer)
+	case string:
+		enc.writeString(buffer, v)
+	case bool:
+		enc.writeBool(buffer, v)
+	case int:
+		enc.writeInt(buffer, int64(v))
+	case int8:
+		enc.writeInt(buffer, int64(v))
+	case int16:
+		enc.writeInt(buffer, int64(v))
+	case int32:
+		enc.writeInt(buffer, int64(v))
+	case int64:
+		enc.writeInt(buffer, v)
+	case uint:
+		enc.writeUint(buffer, uint64(v))
+	case uint8:
+		enc.writeUint(buffer, uint64(v))
+	case uint16:
+		enc.writeUint(buffer, uint64(v))
+	case uint32:
+		enc.writeUint(buffer, uint64(v))
+	case uint64:
+		enc.writeUint(buffer, v)
+	case float32:
+		enc.writeFloat32(buffer, v)
+	case float64:
+		enc.writeFloat64(buffer, v)
+	case time.Time:
+		enc.writeTime(buffer, v)
+	case time.Duration:
+		enc.writeInt(buffer, int64(v))
+	case ByteSize:
+		enc.writeUint(buffer, uint64(v))
+	case Fields:
+		enc.writeMap(buffer, len(v))
+		for k, elem := range v {
+			enc.writeString(buffer, k)
+			writeBinaryValue(enc, buffer, elem)
+		}
+	case []interface{}:
+		enc.writeArray(buffer, len(v))
+		for _, elem := range v {
+			writeBinaryValue(enc, buffer, elem)
+		}
+	case error:
+		enc.writeString(buffer, v.Error())
+	default:
+		enc.writeString(buffer, fmt.Sprint(v))
+	}
+}
+
+// binaryReader consumes the bytes of an encoded event.
+type binaryReader struct {
+	data []byte
+}
+
+func (r *binaryReader) next(n uint64) ([]byte, error) {
+	if uint64(len(r.data)) < n {
+		return nil, errBinaryTruncated
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+func (r *binaryReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// uint reads an n-byte big-endian unsigned integer.
+func (r *binaryReader) uint(n uint64) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// capacity bounds the preallocation for a decoded collection of count
+// elements, since each element occupies at least one byte.
+func (r *binaryReader) capacity(count uint64) int {
+	if count > uint64(len(r.data)) {
+		return len(r.data)
+	}
+	return int(count)
+}
+
+// binaryInt returns non-negative decoded integers as int64 when they fit,
+// and as uint64 otherwise.
+func binaryInt(u uint64) interface{} {
+	if u > 1<<63-1 {
+		return u
+	}
+	return int64(u)
+}
+
+// binaryEvent builds an event from a decoded map.
+func binaryEvent(decoded interface{}) (*Event, error) {
+	m, ok := decoded.(Fields)
+	if !ok {
+		return nil, errors.New("billet/format: encoded event is not a map")
+	}
+
+	t, validTime := m[binaryTimeKey].(time.Time)
+	level, validLevel := m[binaryLevelKey].(int64)
+	if !validTime || !validLevel || level < int64(OFF) || level > int64(DEBUG) {
+		return nil, errors.New("billet/format: encoded event has an invalid time or level")
+	}
+	event := &Event{Time: t, Level: Level(level)}
+
+	var name string
+	if v, present := m[binaryNameKey]; present {
+		if name, ok = v.(string); !ok {
+			return nil, errors.New("billet/format: encoded event name is not a string")
+		}
+	}
+	if event.Message, ok = m[binaryMsgKey].(string); !ok {
+		return nil, errors.New("billet/format: encoded event message is not a string")
+	}
+	if v, present := m[binaryErrorKey]; present {
+		msg, ok := v.(string)
+		if !ok {
+			return nil, errors.New("billet/format: encoded event error is not a string")
+		}
+		event.Error = errors.New(msg)
+	}
+
+	event.Context = EmptyContext.WithName(name)
+	if v, present := m[binaryFieldsKey]; present {
+		fields, ok := v.(Fields)
+		if !ok {
+			return nil, errors.New("billet/format: encoded event fields are not a map")
+		}
+		event.Context = event.Context.With(fields)
+	}
+
+	if v, present := m[binaryFramesKey]; present {
+		frames, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("billet/format: encoded event frames are not an array")
+		}
+		for _, f := range frames {
+			frame, err := binaryFrame(f)
+			if err != nil {
+				return nil, err
+			}
+			event.stack = append(event.stack, frame)
+		}
+	}
+	return event, nil
+}
+
+func binaryFrame(decoded interface{}) (*Frame, error) {
+	parts, ok := decoded.([]interface{})
+	if ok && len(parts) == 4 {
+		pkg, ok1 := parts[0].(string)
+		function, ok2 := parts[1].(string)
+		file, ok3 := parts[2].(string)
+		line, ok4 := parts[3].(int64)
+		if ok1 && ok2 && ok3 && ok4 {
+			return decodedFrame(pkg, function, file, int(line)), nil
+		}
+	}
+	return nil, errors.New("billet/format: encoded event has an invalid frame")
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// binaryCodecs are the encodings that share writeBinaryEvent.
+var binaryCodecs = []struct {
+	name    string
+	enc     binaryEncoder
+	format  Formatter
+	decode  func(data []byte) (*Event, []byte, error)
+	timeTag map[string][]byte // Expected time headers by case name
+}{
+	{
+		name:   "MessagePack",
+		enc:    msgpackEncoder{},
+		format: FormatMsgpack,
+		decode: DecodeMsgpack,
+		timeTag: map[string][]byte{
+			"seconds":  {0xd6, 0xff},
+			"nanos":    {0xd7, 0xff},
+			"wide":     {0xc7, 12, 0xff},
+			"negative": {0xc7, 12, 0xff},
+		},
+	},
+	{
+		name:   "CBOR",
+		enc:    cborEncoder{},
+		format: FormatCBOR,
+		decode: DecodeCBOR,
+		timeTag: map[string][]byte{
+			"seconds":  {0xc1},
+			"nanos":    {0xd9, 0x03, 0xe9},
+			"wide":     {0xd9, 0x03, 0xe9},
+			"negative": {0xc1, 0x20},
+		},
+	},
+}
+
+type binaryStringer struct{}
+
+func (binaryStringer) String() string { return "stringer" }
+
+func encodeBinary(t *testing.T, format Formatter, event *Event) []byte {
+	t.Helper()
+	buffer := NewBuffer()
+	defer ReleaseBuffer(buffer)
+	format(buffer, event)
+	return append([]byte(nil), buffer.Bytes()...)
+}
+
+func TestBinaryValues(t *testing.T) {
+	type binaryValue struct {
+		name           string
+		value, decoded interface{}
+	}
+	values := []binaryValue{
+		{"nil", nil, nil},
+		{"string", "hello", "hello"},
+		{"long string", string(bytes.Repeat([]byte("x"), 300)), string(bytes.Repeat([]byte("x"), 300))},
+		{"true", true, true},
+		{"false", false, false},
+		{"int", 42, int64(42)},
+		{"int8", int8(-100), int64(-100)},
+		{"int16", int16(-1000), int64(-1000)},
+		{"int32", int32(-100000), int64(-100000)},
+		{"int64", int64(1) << 40, int64(1) << 40},
+		{"uint", uint(7), int64(7)},
+		{"uint8", uint8(200), int64(200)},
+		{"uint16", uint16(60000), int64(60000)},
+		{"uint32", uint32(4000000000), int64(4000000000)},
+		{"uint64", uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{"float32", float32(1.5), float32(1.5)},
+		{"float64", 2.25, 2.25},
+		{"duration", 1500 * time.Millisecond, int64(1500000000)},
+		{"byte size", ByteSize(2048), int64(2048)},
+		{"fields", Fields{"a": 1, "b": "two"}, Fields{"a": int64(1), "b": "two"}},
+		{"list", []interface{}{"x", 1, nil}, []interface{}{"x", int64(1), nil}},
+		{"error", errors.New("boom"), "boom"},
+		{"stringer", binaryStringer{}, "stringer"},
+	}
+	// Negative integers on either side of each encoded width
+	for _, i := range []int64{
+		-1, -32, -33, -128, -129, -256, -257, -32768, -32769, -65536, -65537,
+		math.MinInt32, math.MinInt32 - 1, math.MinInt64,
+	} {
+		values = append(values, binaryValue{"negative", i, i})
+	}
+
+	for _, codec := range binaryCodecs {
+		for _, v := range values {
+			event := &Event{
+				Time:    time.Unix(1700000000, 0),
+				Level:   INFO,
+				Context: EmptyContext.WithField("value", v.value),
+				Message: "values",
+			}
+			decoded, rest, err := codec.decode(encodeBinary(t, codec.format, event))
+			if err != nil {
+				t.Errorf("%s %s %v: %v", codec.name, v.name, v.value, err)
+				continue
+			}
+			if len(rest) != 0 {
+				t.Errorf("%s %s: %d bytes left over", codec.name, v.name, len(rest))
+			}
+			if got := decoded.Context.Fields()["value"]; !reflect.DeepEqual(got, v.decoded) {
+				t.Errorf("%s %s: decoded %#v, want %#v", codec.name, v.name, got, v.decoded)
+			}
+		}
+	}
+}
+
+func TestBinaryEvent(t *testing.T) {
+	event := &Event{
+		Time:    time.Unix(1700000000, 0),
+		Level:   ERROR,
+		Context: EmptyContext.WithName("db").WithField("at", time.Unix(1600000000, 500)),
+		Frames:  getFrames(0, maxFrames),
+		Error:   errors.New("connection reset"),
+		Message: "query failed",
+	}
+	stack := event.Stack()
+
+	for _, codec := range binaryCodecs {
+		data := encodeBinary(t, codec.format, event)
+		// Decoding stops after the first event
+		decoded, rest, err := codec.decode(append(data, data...))
+		if err != nil {
+			t.Fatalf("%s: %v", codec.name, err)
+		}
+		if !bytes.Equal(rest, data) {
+			t.Errorf("%s: rest is %d bytes, want the second event", codec.name, len(rest))
+		}
+
+		if !decoded.Time.Equal(event.Time) || decoded.Level != event.Level || decoded.Message != event.Message {
+			t.Errorf("%s: decoded %v %v %q", codec.name, decoded.Time, decoded.Level, decoded.Message)
+		}
+		if decoded.Context.Name() != "db" {
+			t.Errorf("%s: decoded name %q", codec.name, decoded.Context.Name())
+		}
+		if decoded.Error == nil || decoded.Error.Error() != "connection reset" {
+			t.Errorf("%s: decoded error %v", codec.name, decoded.Error)
+		}
+		if at, _ := decoded.Context.Fields()["at"].(time.Time); !at.Equal(time.Unix(1600000000, 500)) {
+			t.Errorf("%s: decoded time field %v", codec.name, decoded.Context.Fields()["at"])
+		}
+
+		frames := decoded.Stack()
+		if len(frames) != len(stack) || len(frames) == 0 {
+			t.Fatalf("%s: decoded %d frames, want %d", codec.name, len(frames), len(stack))
+		}
+		for i, frame := range frames {
+			want := stack[i]
+			if frame.Package() != want.Package() || frame.Function() != want.Function() ||
+				frame.File() != want.File() || frame.Line() != want.Line() {
+				t.Errorf("%s: frame %d is %s.%s %s:%d, want %s.%s %s:%d", codec.name, i,
+					frame.Package(), frame.Function(), frame.File(), frame.Line(),
+					want.Package(), want.Function(), want.File(), want.Line())
+			}
+		}
+	}
+}
+
+func TestBinaryTimestamps(t *testing.T) {
+	times := []struct {
+		name string
+		time time.Time
+	}{
+		{"seconds", time.Unix(1700000000, 0)},
+		{"nanos", time.Unix(1700000000, 123456789)},
+		{"wide", time.Unix(1<<34, 5)},
+		{"negative", time.Unix(-1, 0)},
+	}
+
+	for _, codec := range binaryCodecs {
+		for _, tt := range times {
+			buffer := NewBuffer()
+			codec.enc.writeTime(buffer, tt.time)
+			if want := codec.timeTag[tt.name]; !bytes.HasPrefix(buffer.Bytes(), want) {
+				t.Errorf("%s %s: encoded as % x, want prefix % x", codec.name, tt.name, buffer.Bytes(), want)
+			}
+			ReleaseBuffer(buffer)
+
+			event := &Event{Time: tt.time, Level: INFO, Context: EmptyContext, Message: tt.name}
+			decoded, _, err := codec.decode(encodeBinary(t, codec.format, event))
+			if err != nil {
+				t.Errorf("%s %s: %v", codec.name, tt.name, err)
+			} else if !decoded.Time.Equal(tt.time) {
+				t.Errorf("%s %s: decoded %v, want %v", codec.name, tt.name, decoded.Time, tt.time)
+			}
+		}
+	}
+}
+
+func TestBinaryTruncated(t *testing.T) {
+	event := &Event{
+		Time:    time.Unix(1700000000, 123),
+		Level:   WARN,
+		Context: EmptyContext.WithName("db").With(Fields{"n": -300, "list": []interface{}{1.5, "x"}}),
+		Frames:  getFrames(0, maxFrames),
+		Error:   errors.New("boom"),
+		Message: "truncated",
+	}
+
+	for _, codec := range binaryCodecs {
+		data := encodeBinary(t, codec.format, event)
+		for n := 0; n < len(data); n++ {
+			decoded, rest, err := codec.decode(data[:n])
+			if err != errBinaryTruncated {
+				t.Errorf("%s: decoding %d of %d bytes returned %v, %v", codec.name, n, len(data), decoded, err)
+			}
+			if len(rest) != n {
+				t.Errorf("%s: decoding %d bytes left %d", codec.name, n, len(rest))
+			}
+		}
+	}
+}
+
+// Contexts limit nesting to maxValueDepth, so deeply nested input is
+// written with the encoder directly.
+func TestBinaryDepth(t *testing.T) {
+	for _, codec := range binaryCodecs {
+		for _, tt := range []struct {
+			levels int
+			err    error
+		}{{maxBinaryDepth - 2, nil}, {maxBinaryDepth, errBinaryDepth}, {1000, errBinaryDepth}} {
+			buffer := NewBuffer()
+			codec.enc.writeMap(buffer, 4)
+			codec.enc.writeString(buffer, binaryTimeKey)
+			codec.enc.writeTime(buffer, time.Unix(1700000000, 0))
+			codec.enc.writeString(buffer, binaryLevelKey)
+			codec.enc.writeUint(buffer, uint64(INFO))
+			codec.enc.writeString(buffer, binaryMsgKey)
+			codec.enc.writeString(buffer, "deep")
+			codec.enc.writeString(buffer, binaryFieldsKey)
+			codec.enc.writeMap(buffer, 1)
+			codec.enc.writeString(buffer, "nested")
+			for i := 0; i < tt.levels; i++ {
+				codec.enc.writeArray(buffer, 1)
+			}
+			codec.enc.writeString(buffer, "leaf")
+
+			if _, _, err := codec.decode(buffer.Bytes()); err != tt.err {
+				t.Errorf("%s: decoding %d levels returned %v, want %v", codec.name, tt.levels, err, tt.err)
+			}
+			ReleaseBuffer(buffer)
+		}
+	}
+}
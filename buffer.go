@@ -21,31 +21,81 @@
 package main
 
 import (
-	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
 	"unicode/utf8"
 )
 
-var errBufferWrite = errors.New("write attempted on a buffer that was previously read")
+// Buffers that grew beyond maxPooledBufferSize are left to the garbage
+// collector rather than pinning their memory in the pool.
+const maxPooledBufferSize = 64 << 10
 
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &buffer{
+			bytes: make([]byte, 0, 64),
+		}
+	},
+}
+
+// Buffer is an append-only byte buffer that formatters render into.  The
+// Write methods never fail; their error results exist only to satisfy the
+// standard io interfaces.  Formatters may use Len and Truncate to roll back
+// partial output.
 type Buffer interface {
+	io.Writer
+	io.StringWriter
+	io.ByteWriter
+	io.WriterTo
+
+	// Bytes returns the buffered bytes.  The slice aliases the buffer's
+	// storage and is only valid until the next write, Reset, or Truncate.
 	Bytes() []byte
+
+	// Len returns the number of buffered bytes.
 	Len() int
-	Write(value []byte)
-	WriteByte(c byte)
-	WriteRune(r rune)
-	WriteString(s string)
+
+	// WriteRune appends the UTF-8 encoding of r.
+	WriteRune(r rune) (int, error)
+
+	// Reset empties the buffer, retaining its storage for reuse.
+	Reset()
+
+	// Truncate discards all but the first n buffered bytes.  It panics if n
+	// is negative or greater than Len.
+	Truncate(n int)
+
+	// AppendInt appends the base 10 representation of i.
+	AppendInt(i int64)
+
+	// AppendUint appends the base 10 representation of u.
+	AppendUint(u uint64)
+
+	// AppendFloat appends the representation of f using the format, precision,
+	// and bit size semantics of strconv.FormatFloat.
+	AppendFloat(f float64, fmt byte, prec int, bitSize int)
+
+	// AppendBool appends "true" or "false".
+	AppendBool(b bool)
+
+	// AppendTime appends t formatted according to layout.
+	AppendTime(t time.Time, layout string)
+
+	// AppendQuoted appends s as a double-quoted Go string literal.
+	AppendQuoted(s string)
 }
 
 type buffer struct {
 	bytes   []byte
-	runebuf [utf8.MaxRune]byte
-	read    bool
+	runebuf [utf8.UTFMax]byte
 }
 
+// NewBuffer returns an empty Buffer, reusing a previously released buffer
+// when one is available.
 func NewBuffer() Buffer {
-	return &buffer{
-		bytes: make([]byte, 64),
-	}
+	return bufferPool.Get().(*buffer)
 }
 
 func NewBufferFrom(bytes []byte) Buffer {
@@ -54,8 +104,19 @@ func NewBufferFrom(bytes []byte) Buffer {
 	}
 }
 
+// ReleaseBuffer returns a buffer obtained from NewBuffer to the pool.
+// Neither the buffer nor any slice returned by its Bytes method may be used
+// after the buffer is released.
+func ReleaseBuffer(b Buffer) {
+	buf, ok := b.(*buffer)
+	if !ok || cap(buf.bytes) > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
 func (b *buffer) Bytes() []byte {
-	b.read = true
 	return b.bytes
 }
 
@@ -63,57 +124,75 @@ func (b *buffer) Len() int {
 	return len(b.bytes)
 }
 
-func (b *buffer) WriteByte(value byte) {
-	if b.read {
-		panic(errBufferWrite)
+func (b *buffer) Reset() {
+	b.bytes = b.bytes[:0]
+}
+
+func (b *buffer) Truncate(n int) {
+	if n < 0 || n > len(b.bytes) {
+		panic("billet: buffer truncation out of range")
 	}
+	b.bytes = b.bytes[:n]
+}
 
-	b.ensureCapacity(1)
+func (b *buffer) WriteByte(value byte) error {
 	b.bytes = append(b.bytes, value)
+	return nil
 }
 
-func (b *buffer) WriteRune(value rune) {
-	if b.read {
-		panic(errBufferWrite)
-	}
-
-	if value < utf8.RuneSelf {
-		b.WriteByte(byte(value))
-		return
+func (b *buffer) WriteRune(value rune) (int, error) {
+	// Negative runes are invalid and encode as utf8.RuneError.
+	if value >= 0 && value < utf8.RuneSelf {
+		b.bytes = append(b.bytes, byte(value))
+		return 1, nil
 	}
 
 	size := utf8.EncodeRune(b.runebuf[:], value)
-	b.Write(b.runebuf[:size])
+	b.bytes = append(b.bytes, b.runebuf[:size]...)
+	return size, nil
 }
 
-func (b *buffer) WriteString(value string) {
-	if b.read {
-		panic(errBufferWrite)
-	}
+func (b *buffer) WriteString(value string) (int, error) {
+	b.bytes = append(b.bytes, value...)
+	return len(value), nil
+}
 
-	origlen := len(b.bytes)
-	b.ensureCapacity(len(value))
-	b.bytes = b.bytes[:origlen+len(value)]
-	copy(b.bytes[origlen:], value)
+func (b *buffer) Write(value []byte) (int, error) {
+	b.bytes = append(b.bytes, value...)
+	return len(value), nil
 }
 
-func (b *buffer) Write(value []byte) {
-	if b.read {
-		panic(errBufferWrite)
-	}
+func (b *buffer) AppendInt(i int64) {
+	b.bytes = strconv.AppendInt(b.bytes, i, 10)
+}
+
+func (b *buffer) AppendUint(u uint64) {
+	b.bytes = strconv.AppendUint(b.bytes, u, 10)
+}
+
+func (b *buffer) AppendFloat(f float64, fmt byte, prec int, bitSize int) {
+	b.bytes = strconv.AppendFloat(b.bytes, f, fmt, prec, bitSize)
+}
+
+func (b *buffer) AppendBool(v bool) {
+	b.bytes = strconv.AppendBool(b.bytes, v)
+}
+
+func (b *buffer) AppendTime(t time.Time, layout string) {
+	b.bytes = t.AppendFormat(b.bytes, layout)
+}
 
-	origlen := len(b.bytes)
-	b.ensureCapacity(len(value))
-	b.bytes = b.bytes[:origlen+len(value)]
-	copy(b.bytes[origlen:], value)
+func (b *buffer) AppendQuoted(s string) {
+	b.bytes = strconv.AppendQuote(b.bytes, s)
 }
 
-func (b *buffer) ensureCapacity(size int) {
-	curlen := len(b.bytes)
-	curcap := cap(b.bytes)
-	if curlen+size > curcap {
-		new := make([]byte, curlen, 2*curcap+size)
-		copy(new, b.bytes)
-		b.bytes = new
+// WriteTo writes the buffered bytes to w.  Unlike bytes.Buffer, the
+// contents are left in place, so the same rendering may be written to
+// several destinations.
+func (b *buffer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.bytes)
+	if err == nil && n < len(b.bytes) {
+		err = io.ErrShortWrite
 	}
+	return int64(n), err
 }
@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBufferTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		n      int
+		want   string
+		panics bool
+	}{
+		{0, "", false},
+		{3, "hel", false},
+		{5, "hello", false},
+		{-1, "", true},
+		{6, "", true},
+	} {
+		buffer := NewBufferFrom(nil)
+		buffer.WriteString("hello")
+		func() {
+			defer func() {
+				if panicked := recover() != nil; panicked != tt.panics {
+					t.Errorf("Truncate(%d): panicked %v, want %v", tt.n, panicked, tt.panics)
+				}
+			}()
+			buffer.Truncate(tt.n)
+			if got := string(buffer.Bytes()); got != tt.want || buffer.Len() != len(tt.want) {
+				t.Errorf("Truncate(%d) left %q, want %q", tt.n, got, tt.want)
+			}
+		}()
+	}
+}
+
+func TestBufferReuse(t *testing.T) {
+	buffer := NewBufferFrom(make([]byte, 0, 64))
+	buffer.WriteString("first")
+	first := buffer.Bytes()
+
+	buffer.Reset()
+	if buffer.Len() != 0 || len(buffer.Bytes()) != 0 {
+		t.Fatalf("expected Reset to empty the buffer, got %q", buffer.Bytes())
+	}
+	buffer.WriteByte('s')
+	buffer.WriteRune('é')
+	buffer.WriteRune('😀')
+	buffer.Write([]byte("cond"))
+	if got := string(buffer.Bytes()); got != "sé😀cond" {
+		t.Errorf("expected writes after Reset to start over, got %q", got)
+	}
+	// Reset keeps the storage, so earlier Bytes slices see the new writes.
+	if &first[0] != &buffer.Bytes()[0] {
+		t.Error("expected Reset to reuse the buffer's storage")
+	}
+
+	for _, tt := range []struct {
+		r    rune
+		size int
+	}{{'a', 1}, {'é', 2}, {'€', 3}, {'😀', 4}, {-1, 3}} {
+		buffer.Reset()
+		if n, err := buffer.WriteRune(tt.r); n != tt.size || err != nil || buffer.Len() != tt.size {
+			t.Errorf("WriteRune(%q) wrote %d bytes, want %d", tt.r, n, tt.size)
+		}
+	}
+}
+
+// shortWriter accepts at most limit bytes per write.
+type shortWriter struct {
+	bytes.Buffer
+	limit int
+	err   error
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(p) > w.limit {
+		p = p[:w.limit]
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestBufferWriteTo(t *testing.T) {
+	failed := errors.New("failed")
+	for _, tt := range []struct {
+		name  string
+		w     *shortWriter
+		n     int64
+		err   error
+		wrote string
+	}{
+		{"complete", &shortWriter{limit: 100}, 5, nil, "hello"},
+		{"short", &shortWriter{limit: 2}, 2, io.ErrShortWrite, "he"},
+		{"failed", &shortWriter{err: failed}, 0, failed, ""},
+	} {
+		buffer := NewBufferFrom(nil)
+		buffer.WriteString("hello")
+		n, err := buffer.WriteTo(tt.w)
+		if n != tt.n || err != tt.err || tt.w.String() != tt.wrote {
+			t.Errorf("%s: WriteTo wrote %q and returned %d, %v; want %q, %d, %v",
+				tt.name, tt.w.String(), n, err, tt.wrote, tt.n, tt.err)
+		}
+		// The contents stay in place for writing elsewhere.
+		if got := string(buffer.Bytes()); got != "hello" {
+			t.Errorf("%s: WriteTo left %q", tt.name, got)
+		}
+	}
+}
+
+func TestBufferAppend(t *testing.T) {
+	at := time.Date(2024, 2, 29, 13, 4, 5, 123456789, time.FixedZone("X", -7*3600))
+	for _, tt := range []struct {
+		name   string
+		append func(b Buffer)
+		want   string
+	}{
+		{"int zero", func(b Buffer) { b.AppendInt(0) }, strconv.FormatInt(0, 10)},
+		{"int negative", func(b Buffer) { b.AppendInt(-42) }, strconv.FormatInt(-42, 10)},
+		{"int min", func(b Buffer) { b.AppendInt(math.MinInt64) }, strconv.FormatInt(math.MinInt64, 10)},
+		{"int max", func(b Buffer) { b.AppendInt(math.MaxInt64) }, strconv.FormatInt(math.MaxInt64, 10)},
+		{"uint max", func(b Buffer) { b.AppendUint(math.MaxUint64) }, strconv.FormatUint(math.MaxUint64, 10)},
+		{"float shortest", func(b Buffer) { b.AppendFloat(0.1, 'g', -1, 64) }, strconv.FormatFloat(0.1, 'g', -1, 64)},
+		{"float precision", func(b Buffer) { b.AppendFloat(math.Pi, 'f', 3, 64) }, strconv.FormatFloat(math.Pi, 'f', 3, 64)},
+		{"float32", func(b Buffer) { b.AppendFloat(float64(float32(0.1)), 'g', -1, 32) },
+			strconv.FormatFloat(float64(float32(0.1)), 'g', -1, 32)},
+		{"float exponent", func(b Buffer) { b.AppendFloat(1e21, 'e', -1, 64) }, strconv.FormatFloat(1e21, 'e', -1, 64)},
+		{"float NaN", func(b Buffer) { b.AppendFloat(math.NaN(), 'g', -1, 64) }, strconv.FormatFloat(math.NaN(), 'g', -1, 64)},
+		{"float -Inf", func(b Buffer) { b.AppendFloat(math.Inf(-1), 'g', -1, 64) }, strconv.FormatFloat(math.Inf(-1), 'g', -1, 64)},
+		{"true", func(b Buffer) { b.AppendBool(true) }, strconv.FormatBool(true)},
+		{"false", func(b Buffer) { b.AppendBool(false) }, strconv.FormatBool(false)},
+		{"time RFC3339Nano", func(b Buffer) { b.AppendTime(at, time.RFC3339Nano) }, at.Format(time.RFC3339Nano)},
+		{"time Kitchen", func(b Buffer) { b.AppendTime(at, time.Kitchen) }, at.Format(time.Kitchen)},
+		{"time literal", func(b Buffer) { b.AppendTime(at, "2006-01-02 .000 MST") }, at.Format("2006-01-02 .000 MST")},
+		{"quoted", func(b Buffer) { b.AppendQuoted("a \"b\"\n\x00é") }, strconv.Quote("a \"b\"\n\x00é")},
+		{"quoted invalid UTF-8", func(b Buffer) { b.AppendQuoted("\xff") }, strconv.Quote("\xff")},
+	} {
+		// Appends follow existing content rather than replacing it.
+		buffer := NewBufferFrom(nil)
+		buffer.WriteString("prefix:")
+		tt.append(buffer)
+		if got := string(buffer.Bytes()); got != "prefix:"+tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, "prefix:"+tt.want)
+		}
+	}
+}
+
+func BenchmarkBufferAppend(b *testing.B) {
+	buffer := NewBuffer()
+	defer ReleaseBuffer(buffer)
+	now := time.Now()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer.Reset()
+		buffer.AppendInt(-12345)
+		buffer.AppendUint(12345)
+		buffer.AppendFloat(3.25, 'g', -1, 64)
+		buffer.AppendBool(true)
+		buffer.AppendTime(now, time.RFC3339Nano)
+		buffer.AppendQuoted("quoted")
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// CBOR major types
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// CBOR time tags.  Tag 1001 is the extended time format from RFC 9581,
+// which is used to keep nanosecond precision.
+const (
+	cborTagDateTime     = 0
+	cborTagEpoch        = 1
+	cborTagExtendedTime = 1001
+)
+
+// FormatCBOR renders events as CBOR maps with the time, level, name,
+// message, error, context fields, and frames.  Context values keep their
+// native types.  Times are written with the epoch tag when they have whole
+// seconds and the RFC 9581 extended time tag otherwise.  Use DecodeCBOR to
+// read the events back.
+func FormatCBOR(buffer Buffer, event *Event) {
+	writeBinaryEvent(cborEncoder{}, buffer, event)
+}
+
+// DecodeCBOR decodes the first event rendered by FormatCBOR from data and
+// returns it with the remaining bytes.  Integer fields are decoded as with
+// DecodeMsgpack, and the decoded error only retains its message.
+// Indefinite-length items aren't supported.
+func DecodeCBOR(data []byte) (event *Event, rest []byte, err error) {
+	r := &cborReader{binaryReader{data: data}}
+	decoded, err := r.value(0)
+	if err != nil {
+		return nil, data, err
+	}
+	event, err = binaryEvent(decoded)
+	if err != nil {
+		return nil, data, err
+	}
+	return event, r.data, nil
+}
+
+type cborEncoder struct{}
+
+func (cborEncoder) writeMap(buffer Buffer, n int) {
+	cborHead(buffer, cborMap, uint64(n))
+}
+
+func (cborEncoder) writeArray(buffer Buffer, n int) {
+	cborHead(buffer, cborArray, uint64(n))
+}
+
+func (cborEncoder) writeString(buffer Buffer, s string) {
+	cborHead(buffer, cborText, uint64(len(s)))
+	buffer.WriteString(s)
+}
+
+func (cborEncoder) writeInt(buffer Buffer, i int64) {
+	if i < 0 {
+		cborHead(buffer, cborNegInt, uint64(^i))
+		return
+	}
+	cborHead(buffer, cborUint, uint64(i))
+}
+
+func (cborEncoder) writeUint(buffer Buffer, u uint64) {
+	cborHead(buffer, cborUint, u)
+}
+
+func (cborEncoder) writeFloat32(buffer Buffer, f float32) {
+	buffer.WriteByte(0xfa)
+	writeBigEndian(buffer, uint64(math.Float32bits(f)), 4)
+}
+
+func (cborEncoder) writeFloat64(buffer Buffer, f float64) {
+	buffer.WriteByte(0xfb)
+	writeBigEndian(buffer, math.Float64bits(f), 8)
+}
+
+func (cborEncoder) writeBool(buffer Buffer, b bool) {
+	if b {
+		buffer.WriteByte(0xf5)
+	} else {
+		buffer.WriteByte(0xf4)
+	}
+}
+
+func (cborEncoder) writeNil(buffer Buffer) {
+	buffer.WriteByte(0xf6)
+}
+
+func (e cborEncoder) writeTime(buffer Buffer, t time.Time) {
+	if t.Nanosecond() == 0 {
+		cborHead(buffer, cborTag, cborTagEpoch)
+		e.writeInt(buffer, t.Unix())
+		return
+	}
+	cborHead(buffer, cborTag, cborTagExtendedTime)
+	e.writeMap(buffer, 2)
+	e.writeInt(buffer, 1)
+	e.writeInt(buffer, t.Unix())
+	e.writeInt(buffer, -9)
+	e.writeInt(buffer, int64(t.Nanosecond()))
+}
+
+// cborHead writes the initial bytes of an item with the given major type and
+// argument, using the shortest encoding of the argument.
+func cborHead(buffer Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buffer.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buffer.WriteByte(major | 24)
+		buffer.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buffer.WriteByte(major | 25)
+		writeBigEndian(buffer, arg, 2)
+	case arg <= math.MaxUint32:
+		buffer.WriteByte(major | 26)
+		writeBigEndian(buffer, arg, 4)
+	default:
+		buffer.WriteByte(major | 27)
+		writeBigEndian(buffer, arg, 8)
+	}
+}
+
+type cborReader struct {
+	binaryReader
+}
+
+// head reads an item's major type, additional information, and argument.
+// Simple values and floats are returned with their raw bits as the argument.
+func (r *cborReader) head() (major byte, info byte, arg uint64, err error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+		return major, info, arg, err
+	}
+	return 0, 0, 0, fmt.Errorf("billet/format: unsupported CBOR item 0x%02x", b)
+}
+
+func (r *cborReader) value(depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errBinaryDepth
+	}
+	major, info, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return binaryInt(arg), nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("billet/format: CBOR negative integer overflows int64")
+		}
+		return int64(^arg), nil
+	case cborBytes, cborText:
+		// Byte strings are decoded as strings, since context values never
+		// hold byte slices.
+		b, err := r.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborArray:
+		list := make([]interface{}, 0, r.capacity(arg))
+		for i := uint64(0); i < arg; i++ {
+			elem, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	case cborMap:
+		fields := make(Fields, r.capacity(arg))
+		for i := uint64(0); i < arg; i++ {
+			key, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, errors.New("billet/format: CBOR map key is not a string")
+			}
+			if fields[k], err = r.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return fields, nil
+	case cborTag:
+		return r.tagged(arg, depth)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return cborHalfFloat(uint16(arg)), nil
+	case 26:
+		return math.Float32frombits(uint32(arg)), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, fmt.Errorf("billet/format: unsupported CBOR simple value %d", arg)
+}
+
+// tagged decodes the time tags and returns the content of any other tag
+// as-is.
+func (r *cborReader) tagged(tag uint64, depth int) (interface{}, error) {
+	if tag == cborTagExtendedTime {
+		return r.extendedTime(depth)
+	}
+	content, err := r.value(depth + 1)
+	if err != nil || (tag != cborTagDateTime && tag != cborTagEpoch) {
+		return content, err
+	}
+
+	switch v := content.(type) {
+	case string:
+		if tag == cborTagDateTime {
+			return time.Parse(time.RFC3339Nano, v)
+		}
+	case int64:
+		return time.Unix(v, 0), nil
+	case float32:
+		return cborEpochFloat(float64(v)), nil
+	case float64:
+		return cborEpochFloat(v), nil
+	}
+	return nil, fmt.Errorf("billet/format: invalid CBOR time for tag %d", tag)
+}
+
+// extendedTime decodes the RFC 9581 extended time map.  Only the base time
+// and the millisecond, microsecond, and nanosecond fractions are used.
+func (r *cborReader) extendedTime(depth int) (interface{}, error) {
+	major, _, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, errors.New("billet/format: CBOR extended time is not a map")
+	}
+
+	var sec, nsec int64
+	for i := uint64(0); i < n; i++ {
+		key, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		k, _ := key.(int64)
+		v, _ := value.(int64)
+		switch k {
+		case 1:
+			sec = v
+		case -3:
+			nsec = v * int64(time.Millisecond)
+		case -6:
+			nsec = v * int64(time.Microsecond)
+		case -9:
+			nsec = v
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+func cborEpochFloat(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// cborHalfFloat converts an IEEE 754 half-precision float.
+func cborHalfFloat(h uint16) float32 {
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if frac != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return float32(f)
+}
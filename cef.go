@@ -0,0 +1,264 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	cefVersion            = "0"
+	leefVersion           = "1.0"
+	leefTimeFormat        = "Jan 02 2006 15:04:05"
+	defaultEventIdKey     = "event_id"
+	defaultProductVersion = "1.0"
+)
+
+// CEF configures a formatter for ArcSight Common Event Format messages.  The
+// resulting formatter is meant to be used as the MessageFormatter for the
+// Syslog and StructuredSyslog collectors.
+//
+// The event message is sent as the CEF Name, and the context fields are sent
+// as extension key/value pairs along with the event time (rt) and error
+// (msg).  Extension keys are restricted to ASCII letters and digits, so other
+// characters are removed from field names, and fields that would then repeat
+// an earlier key are skipped.
+type CEF struct {
+	// Required
+	Vendor  string
+	Product string
+
+	// Optional extras
+	Version    string // Default: "1.0"
+	EventIdKey string // Context field used as the Device Event Class ID.  Default: "event_id", falling back to the level name
+}
+
+// Formatter returns a Formatter that renders CEF messages as configured.
+func (c CEF) Formatter() Formatter {
+	if c.Vendor == "" || c.Product == "" {
+		panic("billet/format: CEF vendor and product cannot be empty")
+	}
+	if c.Version == "" {
+		c.Version = defaultProductVersion
+	}
+	if c.EventIdKey == "" {
+		c.EventIdKey = defaultEventIdKey
+	}
+
+	return func(buffer Buffer, event *Event) {
+		fields := event.Context.Fields()
+
+		buffer.WriteString("CEF:")
+		buffer.WriteString(cefVersion)
+		for _, header := range []string{c.Vendor, c.Product, c.Version, eventId(fields, c.EventIdKey, event), event.Message} {
+			buffer.WriteByte('|')
+			writeCEFHeader(buffer, header)
+		}
+		buffer.WriteByte('|')
+		buffer.AppendUint(uint64(cefSeverityFor(event.Level)))
+		buffer.WriteByte('|')
+
+		buffer.WriteString("rt=")
+		buffer.AppendInt(event.Time.UnixNano() / 1e6)
+		if event.Error != nil {
+			buffer.WriteString(" msg=")
+			writeCEFValue(buffer, event.Error.Error())
+		}
+		written := map[string]bool{"rt": true, "msg": event.Error != nil}
+		writeCEFFields(buffer, fields, c.EventIdKey, written, ' ', writeCEFValue)
+	}
+}
+
+// LEEF configures a formatter for IBM QRadar Log Event Extended Format 1.0
+// messages.  Like CEF, it's meant to be used as the MessageFormatter for the
+// Syslog and StructuredSyslog collectors.
+//
+// Attributes are tab-delimited and include the event time (devTime), the
+// severity (sev), the level name (cat), the message (msg), the error, and
+// the context fields.  Field names are restricted as for CEF, and fields
+// that would repeat an earlier attribute are skipped.
+type LEEF struct {
+	// Required
+	Vendor  string
+	Product string
+
+	// Optional extras
+	Version    string // Default: "1.0"
+	EventIdKey string // Context field used as the Event ID.  Default: "event_id", falling back to the level name
+}
+
+// Formatter returns a Formatter that renders LEEF messages as configured.
+func (l LEEF) Formatter() Formatter {
+	if l.Vendor == "" || l.Product == "" {
+		panic("billet/format: LEEF vendor and product cannot be empty")
+	}
+	if l.Version == "" {
+		l.Version = defaultProductVersion
+	}
+	if l.EventIdKey == "" {
+		l.EventIdKey = defaultEventIdKey
+	}
+
+	return func(buffer Buffer, event *Event) {
+		fields := event.Context.Fields()
+
+		buffer.WriteString("LEEF:")
+		buffer.WriteString(leefVersion)
+		for _, header := range []string{l.Vendor, l.Product, l.Version, eventId(fields, l.EventIdKey, event)} {
+			buffer.WriteByte('|')
+			writeCEFHeader(buffer, header)
+		}
+		buffer.WriteByte('|')
+
+		buffer.WriteString("devTime=")
+		buffer.AppendTime(event.Time, leefTimeFormat)
+		buffer.WriteString("\tsev=")
+		buffer.AppendUint(uint64(cefSeverityFor(event.Level)))
+		buffer.WriteString("\tcat=")
+		buffer.WriteString(event.Level.String())
+		buffer.WriteString("\tmsg=")
+		writeLEEFValue(buffer, event.Message)
+		if event.Error != nil {
+			buffer.WriteString("\terror=")
+			writeLEEFValue(buffer, event.Error.Error())
+		}
+		written := map[string]bool{"devTime": true, "sev": true, "cat": true, "msg": true, "error": event.Error != nil}
+		writeCEFFields(buffer, fields, l.EventIdKey, written, '\t', writeLEEFValue)
+	}
+}
+
+// CEF severities range from 0 (lowest) to 10 (highest).  LEEF uses the same
+// scale, ignoring 0.
+func cefSeverityFor(level Level) uint {
+	switch level {
+	case DEBUG:
+		return 1
+	case INFO:
+		return 3
+	case WARN:
+		return 5
+	case ERROR:
+		return 7
+	default:
+		return 10
+	}
+}
+
+func eventId(fields Fields, key string, event *Event) string {
+	if id, ok := fields[key]; ok {
+		return fieldString(id)
+	}
+	return event.Level.String()
+}
+
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case ByteSize:
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeCEFFields writes the fields other than eventIdKey as extension pairs
+// in sorted order, each preceded by sep.  Fields whose keys clash with those
+// already written for the event, or with an earlier field once sanitized,
+// are skipped.
+func writeCEFFields(buffer Buffer, fields Fields, eventIdKey string, written map[string]bool, sep byte, writeValue func(Buffer, string)) {
+	for _, k := range sortedFieldKeys(fields, eventIdKey) {
+		key := cefKey(k)
+		if key == "" || written[key] {
+			continue
+		}
+		written[key] = true
+		buffer.WriteByte(sep)
+		buffer.WriteString(key)
+		buffer.WriteByte('=')
+		writeValue(buffer, fieldString(fields[k]))
+	}
+}
+
+func cefKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return -1
+		}
+	}, name)
+}
+
+// Pipes and backslashes are escaped in headers, and line breaks aren't
+// permitted, so they're replaced with spaces.  The LEEF header rules are the
+// same.
+func writeCEFHeader(buffer Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '|', '\\':
+			buffer.WriteByte('\\')
+			buffer.WriteRune(r)
+		case '\r', '\n':
+			buffer.WriteByte(' ')
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+}
+
+// Extension values escape backslashes, equal signs, and line breaks.
+func writeCEFValue(buffer Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '\\', '=':
+			buffer.WriteByte('\\')
+			buffer.WriteRune(r)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+}
+
+// LEEF attribute values may not contain the tab delimiter or line breaks,
+// so those are escaped along with backslashes.
+func writeLEEFValue(buffer Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\t':
+			buffer.WriteString(`\t`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+}
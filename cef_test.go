@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCEFEscaping(t *testing.T) {
+	for _, tt := range []struct {
+		write func(Buffer, string)
+		input string
+		want  string
+	}{
+		{writeCEFHeader, "plain", `plain`},
+		{writeCEFHeader, "a|b", `a\|b`},
+		{writeCEFHeader, `a\b`, `a\\b`},
+		{writeCEFHeader, "a=b", `a=b`},
+		{writeCEFHeader, "a\r\nb", `a  b`},
+		{writeCEFValue, "a=b", `a\=b`},
+		{writeCEFValue, `a\b`, `a\\b`},
+		{writeCEFValue, "a|b", `a|b`},
+		{writeCEFValue, "a\r\nb", `a\r\nb`},
+		{writeCEFValue, "é", `é`},
+		{writeLEEFValue, "a\tb", `a\tb`},
+		{writeLEEFValue, `a\b`, `a\\b`},
+		{writeLEEFValue, "a=b|c", `a=b|c`},
+		{writeLEEFValue, "a\r\nb", `a\r\nb`},
+	} {
+		buffer := NewBufferFrom(nil)
+		tt.write(buffer, tt.input)
+		if got := string(buffer.Bytes()); got != tt.want {
+			t.Errorf("%q rendered %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCEFFormatter(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := &Event{
+		Time:  at,
+		Level: ERROR,
+		Context: EmptyContext.
+			WithField("event_id", "login|fail").
+			WithField("rt", "spoofed").
+			WithField("msg", "spoofed").
+			WithField("src-ip", "10.0.0.1").
+			WithField("srcip", "dropped").
+			WithField("user", "a=b").
+			WithField("---", "unnamed"),
+		Error:   errors.New(`bad\pass`),
+		Message: "Login failed",
+	}
+
+	format := CEF{Vendor: "Acme", Product: "Gate|way"}.Formatter()
+	want := `CEF:0|Acme|Gate\|way|1.0|login\|fail|Login failed|7|rt=1704164645000 msg=bad\\pass srcip=10.0.0.1 user=a\=b`
+	if got := string(Render(format, event)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	format = LEEF{Vendor: "Acme", Product: "Gateway"}.Formatter()
+	want = "LEEF:1.0|Acme|Gateway|1.0|login\\|fail|devTime=Jan 02 2024 03:04:05\tsev=7\tcat=ERROR\tmsg=Login failed\terror=bad\\\\pass\trt=spoofed\tsrcip=10.0.0.1\tuser=a=b"
+	if got := string(Render(format, event)); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// Without an error, msg is free for a field in CEF.
+	event.Error = nil
+	format = CEF{Vendor: "Acme", Product: "Gateway"}.Formatter()
+	want = `CEF:0|Acme|Gateway|1.0|login\|fail|Login failed|7|rt=1704164645000 msg=spoofed srcip=10.0.0.1 user=a\=b`
+	if got := string(Render(format, event)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ColorMode determines whether Colorizer emits ANSI escape codes.
+type ColorMode uint
+
+const (
+	// ColorAuto emits colors when the output is a terminal.  The NO_COLOR
+	// and FORCE_COLOR environment variables override the detection.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways emits colors regardless of the output, unless NO_COLOR is
+	// set.
+	ColorAlways
+
+	// ColorNever disables colors.
+	ColorNever
+)
+
+// Color is a terminal color: one of the 16 basic ANSI colors, an entry in
+// the 256-color palette, or a 24-bit truecolor value.  The zero Color is the
+// terminal's default color.  Colors beyond the terminal's capabilities are
+// approximated.
+type Color uint32
+
+const (
+	colorKindMask = 0xff000000
+	colorBasic    = 0x01000000
+	color256      = 0x02000000
+	colorRGB      = 0x03000000
+)
+
+// The basic ANSI colors and their bright variants.
+const (
+	Black Color = colorBasic | iota
+	Red
+	Green
+	Yellow
+	Blue
+	Magenta
+	Cyan
+	White
+	BrightBlack
+	BrightRed
+	BrightGreen
+	BrightYellow
+	BrightBlue
+	BrightMagenta
+	BrightCyan
+	BrightWhite
+)
+
+// Color256 returns the color at index n of the 256-color palette.
+func Color256(n uint8) Color {
+	return color256 | Color(n)
+}
+
+// RGB returns a 24-bit truecolor color.
+func RGB(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Style describes how colorized output is rendered.
+type Style struct {
+	Foreground Color
+	Background Color
+	Bold       bool
+	Dim        bool
+	Underline  bool
+}
+
+// Palette maps levels to the styles used to render them.
+type Palette map[Level]Style
+
+var (
+	// DefaultPalette uses the basic ANSI colors.
+	DefaultPalette = Palette{
+		DEBUG: {Foreground: Blue},
+		INFO:  {Foreground: Green},
+		WARN:  {Foreground: Yellow},
+		ERROR: {Foreground: Red},
+		FATAL: {Foreground: Red, Bold: true},
+	}
+
+	// Palette256 uses softer colors from the 256-color palette.
+	Palette256 = Palette{
+		DEBUG: {Foreground: Color256(67)},
+		INFO:  {Foreground: Color256(71)},
+		WARN:  {Foreground: Color256(178)},
+		ERROR: {Foreground: Color256(167)},
+		FATAL: {Foreground: Color256(231), Background: Color256(160), Bold: true},
+	}
+
+	// TruecolorPalette uses 24-bit colors.
+	TruecolorPalette = Palette{
+		DEBUG: {Foreground: RGB(0x6c, 0x9e, 0xd8)},
+		INFO:  {Foreground: RGB(0x7c, 0xc3, 0x6e)},
+		WARN:  {Foreground: RGB(0xe6, 0xb4, 0x50)},
+		ERROR: {Foreground: RGB(0xe0, 0x60, 0x5a)},
+		FATAL: {Foreground: RGB(0xff, 0xff, 0xff), Background: RGB(0xc0, 0x20, 0x20), Bold: true},
+	}
+)
+
+// colorProfile describes the colors a terminal supports, from none to
+// 24-bit truecolor.
+type colorProfile uint
+
+const (
+	profileNone colorProfile = iota
+	profileBasic
+	profile256
+	profileTruecolor
+)
+
+const sgrReset = "\x1b[0m"
+
+// Colorize wraps the formatter's output in the event level's color from
+// DefaultPalette when standard output is a terminal.  Wrap only part of a
+// layout, such as FormatLevel, to colorize just that part.
+func Colorize(formatter Formatter) Formatter {
+	return Colorizer{}.Colorize(formatter)
+}
+
+// Colorizer configures terminal colors.
+type Colorizer struct {
+	Palette  Palette   // Default: DefaultPalette
+	KeyStyle Style     // Style for field keys rendered by Fields.  Default: dim
+	Mode     ColorMode // Default: ColorAuto
+	Output   *os.File  // Terminal detection target.  Default: os.Stdout
+}
+
+// Colorize wraps the formatter's output in the style for the event's level.
+func (c Colorizer) Colorize(formatter Formatter) Formatter {
+	profile := c.profile()
+	if profile == profileNone {
+		return formatter
+	}
+	palette := c.Palette
+	if palette == nil {
+		palette = DefaultPalette
+	}
+	codes := make(map[Level]string)
+	for level, style := range palette {
+		codes[level] = style.sgr(profile)
+	}
+
+	return func(buffer Buffer, event *Event) {
+		code := codes[event.Level]
+		if code == "" {
+			formatter(buffer, event)
+			return
+		}
+		buffer.WriteString(code)
+		formatter(buffer, event)
+		buffer.WriteString(sgrReset)
+	}
+}
+
+// Fields renders the event's context like FormatHumanContext, with the keys
+// rendered in KeyStyle.
+func (c Colorizer) Fields() Formatter {
+	return c.fields(" ").format
+}
+
+// fields is like Fields, but separates the key=value pairs with sep.
+func (c Colorizer) fields(sep string) humanContext {
+	writeKey := writeHumanKey
+	if profile := c.profile(); profile != profileNone {
+		style := c.KeyStyle
+		if style == (Style{}) {
+			style = Style{Dim: true}
+		}
+		code := style.sgr(profile)
+		writeKey = func(buffer Buffer, key string) {
+			buffer.WriteString(code)
+			buffer.WriteString(key)
+			buffer.WriteString(sgrReset)
+		}
+	}
+
+	return humanContext{sep: sep, writeKey: writeKey}
+}
+
+// Style wraps the formatter's output in the given style, regardless of the
+// event's level.
+func (c Colorizer) Style(style Style, formatter Formatter) Formatter {
+	profile := c.profile()
+	if profile == profileNone {
+		return formatter
+	}
+	code := style.sgr(profile)
+	if code == "" {
+		return formatter
+	}
+	return func(buffer Buffer, event *Event) {
+		buffer.WriteString(code)
+		formatter(buffer, event)
+		buffer.WriteString(sgrReset)
+	}
+}
+
+func (c Colorizer) profile() colorProfile {
+	if os.Getenv("NO_COLOR") != "" || c.Mode == ColorNever {
+		return profileNone
+	}
+
+	output := c.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	// FORCE_COLOR follows the common convention: 0 or false disables colors,
+	// 1 through 3 select basic, 256-color, and truecolor support, and any
+	// other value enables colors with the detected support.
+	force := os.Getenv("FORCE_COLOR")
+	switch force {
+	case "0", "false":
+		return profileNone
+	case "1", "2", "3":
+		n, _ := strconv.Atoi(force)
+		return colorProfile(n)
+	}
+	term := os.Getenv("TERM")
+	if c.Mode == ColorAuto && force == "" && (term == "dumb" || !isTerminal(output)) {
+		return profileNone
+	}
+
+	colorterm := os.Getenv("COLORTERM")
+	switch {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		return profileTruecolor
+	case strings.Contains(term, "256color"):
+		return profile256
+	default:
+		return profileBasic
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// sgr returns the escape sequence that selects the style, approximating
+// colors the profile doesn't support.
+func (s Style) sgr(profile colorProfile) string {
+	var params []string
+	if s.Bold {
+		params = append(params, "1")
+	}
+	if s.Dim {
+		params = append(params, "2")
+	}
+	if s.Underline {
+		params = append(params, "4")
+	}
+	if s.Foreground != 0 {
+		params = append(params, s.Foreground.sgr(profile, false))
+	}
+	if s.Background != 0 {
+		params = append(params, s.Background.sgr(profile, true))
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func (c Color) sgr(profile colorProfile, background bool) string {
+	c = c.downgrade(profile)
+	value := uint32(c &^ colorKindMask)
+	switch c & colorKindMask {
+	case color256:
+		if background {
+			return "48;5;" + strconv.Itoa(int(value))
+		}
+		return "38;5;" + strconv.Itoa(int(value))
+	case colorRGB:
+		prefix := "38;2;"
+		if background {
+			prefix = "48;2;"
+		}
+		return prefix + strconv.Itoa(int(value>>16)) + ";" + strconv.Itoa(int(value>>8&0xff)) + ";" + strconv.Itoa(int(value&0xff))
+	default:
+		base := 30
+		if value >= 8 {
+			base, value = 90, value-8
+		}
+		if background {
+			base += 10
+		}
+		return strconv.Itoa(base + int(value))
+	}
+}
+
+// downgrade approximates the color within the profile's capabilities.
+func (c Color) downgrade(profile colorProfile) Color {
+	kind := c & colorKindMask
+	switch {
+	case kind == colorRGB && profile == profile256:
+		r, g, b := c.rgb()
+		return Color256(uint8(16 + 36*cubeIndex(r) + 6*cubeIndex(g) + cubeIndex(b)))
+	case kind != colorBasic && profile == profileBasic:
+		if kind == color256 && c&0xff < 16 {
+			return colorBasic | c&0xff
+		}
+		r, g, b := c.rgb()
+		n := Color(0)
+		if r > 0x7f {
+			n |= 1
+		}
+		if g > 0x7f {
+			n |= 2
+		}
+		if b > 0x7f {
+			n |= 4
+		}
+		if r > 0xc0 || g > 0xc0 || b > 0xc0 {
+			n += 8
+		}
+		return colorBasic | n
+	default:
+		return c
+	}
+}
+
+// rgb returns the color's components.  256-color palette entries are
+// converted using the standard xterm values.
+func (c Color) rgb() (r, g, b uint8) {
+	value := uint32(c &^ colorKindMask)
+	if c&colorKindMask == colorRGB {
+		return uint8(value >> 16), uint8(value >> 8), uint8(value)
+	}
+	switch {
+	case value >= 232:
+		gray := uint8(8 + 10*(value-232))
+		return gray, gray, gray
+	case value >= 16:
+		value -= 16
+		return cubeLevel(value / 36), cubeLevel(value / 6 % 6), cubeLevel(value % 6)
+	default:
+		return 0, 0, 0
+	}
+}
+
+func cubeIndex(v uint8) int {
+	if v < 48 {
+		return 0
+	}
+	if v < 115 {
+		return 1
+	}
+	return (int(v) - 35) / 40
+}
+
+func cubeLevel(i uint32) uint8 {
+	if i == 0 {
+		return 0
+	}
+	return uint8(55 + 40*i)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestColorizerProfile(t *testing.T) {
+	pipe, err := os.CreateTemp(t.TempDir(), "color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+
+	for _, tt := range []struct {
+		mode                            ColorMode
+		noColor, force, term, colorterm string
+		want                            colorProfile
+	}{
+		{ColorAuto, "", "", "xterm-256color", "truecolor", profileNone},
+		{ColorAlways, "", "", "xterm", "", profileBasic},
+		{ColorAlways, "", "", "xterm-256color", "", profile256},
+		{ColorAlways, "", "", "xterm", "truecolor", profileTruecolor},
+		{ColorAlways, "", "", "dumb", "24bit", profileTruecolor},
+		{ColorAlways, "1", "3", "xterm", "truecolor", profileNone},
+		{ColorNever, "", "3", "xterm", "truecolor", profileNone},
+		{ColorAuto, "", "1", "", "truecolor", profileBasic},
+		{ColorAuto, "", "2", "", "", profile256},
+		{ColorAuto, "", "3", "", "", profileTruecolor},
+		{ColorAuto, "", "yes", "xterm-256color", "", profile256},
+		{ColorAuto, "", "yes", "dumb", "", profileBasic},
+		{ColorAlways, "", "0", "xterm", "", profileNone},
+		{ColorAlways, "", "false", "xterm", "", profileNone},
+	} {
+		t.Setenv("NO_COLOR", tt.noColor)
+		t.Setenv("FORCE_COLOR", tt.force)
+		t.Setenv("TERM", tt.term)
+		t.Setenv("COLORTERM", tt.colorterm)
+		if got := (Colorizer{Mode: tt.mode, Output: pipe}).profile(); got != tt.want {
+			t.Errorf("%+v: got profile %d, want %d", tt, got, tt.want)
+		}
+	}
+}
+
+func TestStyleSGR(t *testing.T) {
+	for _, tt := range []struct {
+		style   Style
+		profile colorProfile
+		want    string
+	}{
+		{Style{}, profileTruecolor, ""},
+		{Style{Foreground: Red}, profileBasic, "\x1b[31m"},
+		{Style{Underline: true, Background: BrightBlue}, profileBasic, "\x1b[4;104m"},
+		{Style{Foreground: BrightWhite, Background: Red, Bold: true}, profileTruecolor, "\x1b[1;97;41m"},
+		{Style{Dim: true, Foreground: Color256(67)}, profile256, "\x1b[2;38;5;67m"},
+		{Style{Background: RGB(1, 2, 3)}, profileTruecolor, "\x1b[48;2;1;2;3m"},
+		{Style{Foreground: RGB(0xe0, 0x60, 0x5a)}, profile256, "\x1b[38;5;167m"},
+		{Style{Foreground: RGB(0xe0, 0x60, 0x5a)}, profileBasic, "\x1b[91m"},
+	} {
+		if got := tt.style.sgr(tt.profile); got != tt.want {
+			t.Errorf("%+v in profile %d: got %q, want %q", tt.style, tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestColorDowngrade(t *testing.T) {
+	for _, tt := range []struct {
+		color   Color
+		profile colorProfile
+		want    Color
+	}{
+		{Red, profileBasic, Red},
+		{Red, profile256, Red},
+		{Color256(1), profileBasic, Red},
+		{Color256(12), profileBasic, BrightBlue},
+		{Color256(160), profileBasic, BrightRed},
+		{Color256(244), profileBasic, White},
+		{Color256(160), profileTruecolor, Color256(160)},
+		{RGB(0xe0, 0x60, 0x5a), profile256, Color256(167)},
+		{RGB(0, 0, 0), profile256, Color256(16)},
+		{RGB(0xff, 0xff, 0xff), profile256, Color256(231)},
+		{RGB(0xe0, 0x60, 0x5a), profileBasic, BrightRed},
+		{RGB(0x20, 0x90, 0x20), profileBasic, Green},
+		{RGB(1, 2, 3), profileTruecolor, RGB(1, 2, 3)},
+	} {
+		if got := tt.color.downgrade(tt.profile); got != tt.want {
+			t.Errorf("%#x in profile %d: got %#x, want %#x", tt.color, tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestColorize(t *testing.T) {
+	event := &Event{Time: time.Now(), Level: ERROR, Context: EmptyContext.WithField("user", "bob")}
+	info := &Event{Time: event.Time, Level: INFO, Context: EmptyContext}
+	for _, tt := range []struct {
+		force     string
+		colorizer Colorizer
+		formatter Formatter
+		event     *Event
+		want      string
+	}{
+		{"1", Colorizer{}, FormatLevel, event, "\x1b[31mERROR\x1b[0m"},
+		{"1", Colorizer{Palette: TruecolorPalette}, FormatLevel, event, "\x1b[91mERROR\x1b[0m"},
+		{"2", Colorizer{Palette: TruecolorPalette}, FormatLevel, event, "\x1b[38;5;167mERROR\x1b[0m"},
+		{"3", Colorizer{Palette: Palette256}, FormatLevel, event, "\x1b[38;5;167mERROR\x1b[0m"},
+		{"1", Colorizer{Palette: Palette{ERROR: {Bold: true}}}, FormatLevel, info, "INFO"},
+		{"0", Colorizer{}, FormatLevel, event, "ERROR"},
+	} {
+		t.Setenv("NO_COLOR", "")
+		t.Setenv("FORCE_COLOR", tt.force)
+		formatter := tt.colorizer.Colorize(tt.formatter)
+		if got := string(Render(formatter, tt.event)); got != tt.want {
+			t.Errorf("FORCE_COLOR=%s %+v: got %q, want %q", tt.force, tt.colorizer, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		force     string
+		colorizer Colorizer
+		want      string
+	}{
+		{"1", Colorizer{}, "\x1b[2muser\x1b[0m=bob"},
+		{"1", Colorizer{KeyStyle: Style{Underline: true}}, "\x1b[4muser\x1b[0m=bob"},
+		{"0", Colorizer{}, "user=bob"},
+	} {
+		t.Setenv("FORCE_COLOR", tt.force)
+		if got := string(Render(tt.colorizer.Fields(), event)); got != tt.want {
+			t.Errorf("FORCE_COLOR=%s %+v fields: got %q, want %q", tt.force, tt.colorizer, got, tt.want)
+		}
+	}
+}
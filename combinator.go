@@ -0,0 +1,187 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Pad pads the formatter's output with spaces to at least the absolute value
+// of width characters.  Positive widths right-align the output and negative
+// widths left-align it, as with fmt's %5v and %-5v.
+func Pad(width int, formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		pad(buffer, origlen, width)
+	}
+}
+
+// Truncate limits the formatter's output to at most length characters.
+func Truncate(length int, formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		truncate(buffer, origlen, length)
+	}
+}
+
+// Fixed pads or truncates the formatter's output to exactly the absolute
+// value of width characters, aligning it as with Pad.
+func Fixed(width int, formatter Formatter) Formatter {
+	length := width
+	if length < 0 {
+		length = -length
+	}
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		truncate(buffer, origlen, length)
+		pad(buffer, origlen, width)
+	}
+}
+
+// Upper converts the formatter's output to upper case.
+func Upper(formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		mapCase(buffer, origlen, 'a', 'z', bytes.ToUpper)
+	}
+}
+
+// Lower converts the formatter's output to lower case.
+func Lower(formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		mapCase(buffer, origlen, 'A', 'Z', bytes.ToLower)
+	}
+}
+
+// IfLevel applies the formatter only to events at or above the threshold
+// level.  IfLevel(WARN, HumanSource), for example, renders source locations
+// for WARN, ERROR, and FATAL events.
+func IfLevel(threshold Level, formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		if event.Level.within(threshold) {
+			formatter(buffer, event)
+		}
+	}
+}
+
+// IfField applies the formatter only to events whose context contains the
+// given field key.
+func IfField(key string, formatter Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		found := false
+		event.Context.Each(func(name string, value interface{}) {
+			if name == key {
+				found = true
+			}
+		})
+		if found {
+			formatter(buffer, event)
+		}
+	}
+}
+
+// Switch calls choose for each event and applies the formatter it returns.
+// Nothing is written if choose returns nil.
+func Switch(choose func(event *Event) Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		if formatter := choose(event); formatter != nil {
+			formatter(buffer, event)
+		}
+	}
+}
+
+// Default applies the formatter, falling back to the fallback formatter if
+// the first one writes nothing.
+func Default(formatter Formatter, fallback Formatter) Formatter {
+	return func(buffer Buffer, event *Event) {
+		origlen := buffer.Len()
+		formatter(buffer, event)
+		if buffer.Len() == origlen {
+			fallback(buffer, event)
+		}
+	}
+}
+
+// pad pads the bytes written since origlen as described for Pad.
+func pad(buffer Buffer, origlen int, width int) {
+	leftAlign := width < 0
+	if leftAlign {
+		width = -width
+	}
+	count := width - utf8.RuneCount(buffer.Bytes()[origlen:])
+	if count <= 0 {
+		return
+	}
+
+	endlen := buffer.Len()
+	for i := 0; i < count; i++ {
+		buffer.WriteByte(' ')
+	}
+	if leftAlign {
+		return
+	}
+
+	// Shift the output right and move the padding in front of it
+	b := buffer.Bytes()
+	copy(b[origlen+count:], b[origlen:endlen])
+	for i := origlen; i < origlen+count; i++ {
+		b[i] = ' '
+	}
+}
+
+// truncate limits the bytes written since origlen to length runes.
+func truncate(buffer Buffer, origlen int, length int) {
+	written := buffer.Bytes()[origlen:]
+	for offset := range string(written) {
+		if length == 0 {
+			buffer.Truncate(origlen + offset)
+			return
+		}
+		length--
+	}
+}
+
+// mapCase changes the case of the bytes written since origlen.  ASCII
+// output is converted in place; anything else falls back to the given
+// bytes package function.
+func mapCase(buffer Buffer, origlen int, from byte, to byte, fallback func([]byte) []byte) {
+	written := buffer.Bytes()[origlen:]
+	for _, c := range written {
+		if c >= utf8.RuneSelf {
+			mapped := fallback(written)
+			buffer.Truncate(origlen)
+			buffer.Write(mapped)
+			return
+		}
+	}
+	for i, c := range written {
+		if c >= from && c <= to {
+			written[i] = c ^ 0x20
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"testing"
+)
+
+// renderAfter renders the formatter after a prefix, so tests check that
+// combinators only touch their own output.
+func renderAfter(formatter Formatter, event *Event) string {
+	buffer := NewBufferFrom(nil)
+	buffer.WriteString("pre|")
+	formatter(buffer, event)
+	return string(buffer.Bytes())
+}
+
+func TestWidthCombinators(t *testing.T) {
+	event := &Event{Context: EmptyContext}
+	for _, tt := range []struct {
+		name      string
+		formatter Formatter
+		want      string
+	}{
+		{"pad right-aligns", Pad(5, Literal("ab")), "   ab"},
+		{"pad left-aligns", Pad(-5, Literal("ab")), "ab   "},
+		{"pad leaves wide output", Pad(2, Literal("abc")), "abc"},
+		{"pad zero", Pad(0, Literal("abc")), "abc"},
+		{"pad counts runes", Pad(4, Literal("é")), "   é"},
+		{"pad empty", Pad(-2, Literal("")), "  "},
+		{"truncate", Truncate(3, Literal("abcdef")), "abc"},
+		{"truncate short output", Truncate(10, Literal("abc")), "abc"},
+		{"truncate zero", Truncate(0, Literal("abc")), ""},
+		{"truncate multibyte", Truncate(3, Literal("héllo")), "hél"},
+		{"truncate emoji", Truncate(1, Literal("😀😀")), "😀"},
+		{"fixed pads", Fixed(4, Literal("ab")), "  ab"},
+		{"fixed left-aligns", Fixed(-4, Literal("ab")), "ab  "},
+		{"fixed truncates", Fixed(3, Literal("héllo")), "hél"},
+		{"fixed left-aligned truncates", Fixed(-3, Literal("😀abc")), "😀ab"},
+		{"upper", Upper(Literal("abc-1z")), "ABC-1Z"},
+		{"upper multibyte", Upper(Literal("héllo")), "HÉLLO"},
+		{"lower", Lower(Literal("ABC-1Z")), "abc-1z"},
+		{"lower multibyte", Lower(Literal("ÉCOLE")), "école"},
+		{"nested", Pad(-6, Upper(Truncate(3, Literal("hello")))), "HEL   "},
+	} {
+		if got := renderAfter(tt.formatter, event); got != "pre|"+tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, "pre|"+tt.want)
+		}
+	}
+}
+
+func TestConditionalCombinators(t *testing.T) {
+	byLevel := Switch(func(event *Event) Formatter {
+		switch event.Level {
+		case ERROR:
+			return Literal("error")
+		case INFO:
+			return Literal("info")
+		}
+		return nil
+	})
+	withUser := EmptyContext.WithName("db").WithField("user", "bob").WithField("ip", "10.0.0.1")
+
+	for _, tt := range []struct {
+		name      string
+		formatter Formatter
+		level     Level
+		context   Context
+		want      string
+	}{
+		{"IfLevel below threshold", IfLevel(WARN, Literal("x")), INFO, EmptyContext, ""},
+		{"IfLevel at threshold", IfLevel(WARN, Literal("x")), WARN, EmptyContext, "x"},
+		{"IfLevel above threshold", IfLevel(WARN, Literal("x")), FATAL, EmptyContext, "x"},
+		{"IfLevel OFF event", IfLevel(DEBUG, Literal("x")), OFF, EmptyContext, ""},
+		{"IfField present", IfField("user", Literal("x")), INFO, withUser, "x"},
+		{"IfField in parent", IfField("user", Literal("x")), INFO, withUser.WithField("a", 1), "x"},
+		{"IfField absent", IfField("host", Literal("x")), INFO, withUser, ""},
+		{"IfField empty context", IfField("user", Literal("x")), INFO, EmptyContext, ""},
+		{"Switch chosen", byLevel, ERROR, EmptyContext, "error"},
+		{"Switch other", byLevel, INFO, EmptyContext, "info"},
+		{"Switch nil", byLevel, DEBUG, EmptyContext, ""},
+		{"Default used", Default(IfLevel(ERROR, Literal("x")), Literal("fallback")), INFO, EmptyContext, "fallback"},
+		{"Default not used", Default(Literal("x"), Literal("fallback")), INFO, EmptyContext, "x"},
+		{"Default name", Default(formatName, Literal("root")), INFO, withUser, "db"},
+	} {
+		event := &Event{Level: tt.level, Context: tt.context}
+		if got := renderAfter(tt.formatter, event); got != "pre|"+tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, "pre|"+tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	consoleDefaultTimeFormat = "15:04:05.000"
+	consoleDefaultWidth      = 100
+	consoleIndent            = "    "
+)
+
+// ConsoleBadges renders levels as badges with colored backgrounds.
+var ConsoleBadges = Palette{
+	DEBUG: {Foreground: Black, Background: Blue},
+	INFO:  {Foreground: Black, Background: Green},
+	WARN:  {Foreground: Black, Background: Yellow},
+	ERROR: {Foreground: BrightWhite, Background: Red, Bold: true},
+	FATAL: {Foreground: BrightWhite, Background: Magenta, Bold: true},
+}
+
+// FormatConsole renders events for reading in a terminal during local
+// development using the default Console options.
+var FormatConsole = Console{}.Formatter()
+
+// Console configures a multi-line formatter for local development.  Each
+// event starts with a dimmed timestamp, a colored level badge, and the
+// message in aligned columns.  Context fields follow on the same line when
+// they fit within Width, and are otherwise printed one per line, indented.
+// Multi-line messages and stacks are indented beneath the event.  Since the
+// zero StackLevel selects the default, set NoStacks to omit stacks.  Colors
+// follow the Colorizer's settings and are omitted when the output isn't a
+// terminal.
+type Console struct {
+	TimeFormat string    // Default: "15:04:05.000"
+	Width      int       // Default: the terminal's width, else $COLUMNS, else 100
+	Badges     Palette   // Default: ConsoleBadges
+	Colorizer  Colorizer // Default: automatic terminal detection
+	StackLevel Level     // Render stacks for events at or above this level.  Default: ERROR
+	NoStacks   bool      // Never render stacks, regardless of StackLevel
+
+	PriorityKeys []string // Context keys to render first, as in HumanContext
+}
+
+// Formatter returns a Formatter that renders events as configured.
+func (c Console) Formatter() Formatter {
+	if c.TimeFormat == "" {
+		c.TimeFormat = consoleDefaultTimeFormat
+	}
+	if c.Width <= 0 {
+		c.Width = consoleWidth(c.Colorizer.Output)
+	}
+	if c.Badges == nil {
+		c.Badges = ConsoleBadges
+	}
+	if c.StackLevel == OFF {
+		c.StackLevel = ERROR
+	}
+
+	badges := c.Colorizer
+	badges.Palette = c.Badges
+	var (
+		timestamp = c.Colorizer.Style(Style{Dim: true}, TimeFormatter(c.TimeFormat))
+		badge     = badges.Colorize(Fixed(-7, Join("", Literal(" "), FormatLevel)))
+		name      = c.Colorizer.Style(Style{Bold: true}, formatName)
+		source    = c.Colorizer.Style(Style{Dim: true}, HumanSource)
+		inline    = c.Colorizer.fields(" ")
+		multiline = c.Colorizer.fields("\n" + consoleIndent)
+		stack     = c.Colorizer.Style(Style{Dim: true}, FormatStack)
+	)
+	inline.priority = c.PriorityKeys
+	multiline.priority = c.PriorityKeys
+
+	return func(buffer Buffer, event *Event) {
+		linestart := buffer.Len()
+		timestamp(buffer, event)
+		buffer.WriteByte(' ')
+		badge(buffer, event)
+		buffer.WriteByte(' ')
+		if event.Context.Name() != "" {
+			name(buffer, event)
+			buffer.WriteString(": ")
+		}
+
+		message := strings.TrimRight(event.Message, " \t\r\n")
+		first, rest := message, ""
+		if idx := strings.IndexByte(message, '\n'); idx != -1 {
+			first, rest = message[:idx], message[idx+1:]
+		}
+		buffer.WriteString(strings.TrimRight(first, "\r"))
+		if event.HasFrames() {
+			buffer.WriteString("  ")
+			source(buffer, event)
+		}
+		if event.Error != nil {
+			buffer.WriteString("  error=")
+			writeHumanString(buffer, event.Error.Error())
+		}
+
+		if event.Context.NumFields() > 0 {
+			fieldstart := buffer.Len()
+			buffer.WriteString("  ")
+			inline.format(buffer, event)
+			if visibleWidth(buffer.Bytes()[linestart:]) > c.Width {
+				buffer.Truncate(fieldstart)
+				buffer.WriteString("\n" + consoleIndent)
+				multiline.format(buffer, event)
+			}
+		}
+
+		for _, line := range strings.Split(rest, "\n") {
+			if rest == "" {
+				break
+			}
+			buffer.WriteString("\n" + consoleIndent + "| ")
+			buffer.WriteString(strings.TrimRight(line, "\r"))
+		}
+
+		if !c.NoStacks && event.HasFrames() && event.Level.within(c.StackLevel) {
+			stackstart := buffer.Len()
+			buffer.WriteByte('\n')
+			stack(buffer, event)
+			indentLines(buffer, stackstart)
+		}
+	}
+}
+
+// consoleWidth returns the width of output when it's a terminal, falling
+// back to the COLUMNS environment variable and then a default.  A nil
+// output means os.Stdout, as for Colorizer.
+func consoleWidth(output *os.File) int {
+	if output == nil {
+		output = os.Stdout
+	}
+	if isTerminal(output) {
+		if columns := terminalWidth(output); columns > 0 {
+			return columns
+		}
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return consoleDefaultWidth
+}
+
+// visibleWidth counts the runes in b that a terminal would display,
+// skipping ANSI escape sequences.
+func visibleWidth(b []byte) int {
+	width := 0
+	for i := 0; i < len(b); {
+		if b[i] == 0x1b {
+			for i < len(b) && b[i] != 'm' {
+				i++
+			}
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRune(b[i:])
+		i += size
+		width++
+	}
+	return width
+}
+
+// indentLines indents every line following a newline written since start.
+func indentLines(buffer Buffer, start int) {
+	written := append([]byte(nil), buffer.Bytes()[start:]...)
+	buffer.Truncate(start)
+	for i, line := range strings.Split(string(written), "\n") {
+		if i > 0 {
+			buffer.WriteString("\n" + consoleIndent)
+		}
+		buffer.WriteString(line)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleWidthFallback(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	t.Setenv("COLUMNS", "132")
+	if width := consoleWidth(file); width != 132 {
+		t.Errorf("consoleWidth with $COLUMNS = %d, want 132", width)
+	}
+	t.Setenv("COLUMNS", "")
+	if width := consoleWidth(file); width != consoleDefaultWidth {
+		t.Errorf("consoleWidth without $COLUMNS = %d, want %d", width, consoleDefaultWidth)
+	}
+}
+
+func TestConsoleWithoutColor(t *testing.T) {
+	pipe, err := os.CreateTemp(t.TempDir(), "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+
+	event := &Event{
+		Time:    time.Now(),
+		Level:   ERROR,
+		Context: EmptyContext.WithName("db").WithField("user", "bob"),
+		Frames:  getFrames(0, maxFrames),
+		Message: "failed",
+	}
+	for _, tt := range []struct {
+		name    string
+		noColor string
+		mode    ColorMode
+		escapes bool
+	}{
+		{"NO_COLOR", "1", ColorAlways, false},
+		{"ColorNever", "", ColorNever, false},
+		{"piped", "", ColorAuto, false},
+		{"ColorAlways", "", ColorAlways, true},
+	} {
+		t.Setenv("NO_COLOR", tt.noColor)
+		t.Setenv("FORCE_COLOR", "")
+		formatter := Console{Colorizer: Colorizer{Mode: tt.mode, Output: pipe}}.Formatter()
+		rendered := string(Render(formatter, event))
+		if got := strings.Contains(rendered, "\x1b["); got != tt.escapes {
+			t.Errorf("%s: escapes %v, want %v: %q", tt.name, got, tt.escapes, rendered)
+		}
+	}
+}
+
+func TestConsoleStacks(t *testing.T) {
+	event := &Event{
+		Time:    time.Now(),
+		Context: EmptyContext,
+		Frames:  getFrames(0, maxFrames),
+		Message: "failed",
+	}
+	for _, tt := range []struct {
+		name    string
+		console Console
+		level   Level
+		stack   bool
+	}{
+		{"default below", Console{}, WARN, false},
+		{"default at", Console{}, ERROR, true},
+		{"default above", Console{}, FATAL, true},
+		{"lowered", Console{StackLevel: DEBUG}, INFO, true},
+		{"disabled", Console{NoStacks: true}, FATAL, false},
+		{"disabled with level", Console{StackLevel: DEBUG, NoStacks: true}, ERROR, false},
+	} {
+		tt.console.Colorizer.Mode = ColorNever
+		event.Level = tt.level
+		rendered := string(Render(tt.console.Formatter(), event))
+		if got := strings.Contains(rendered, ".TestConsoleStacks\n"); got != tt.stack {
+			t.Errorf("%s: stack %v, want %v:\n%s", tt.name, got, tt.stack, rendered)
+		}
+	}
+}
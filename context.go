@@ -22,6 +22,8 @@ package main
 
 import (
 	"fmt"
+	"reflect"
+	"time"
 )
 
 var emptyFields = (*fieldList)(nil)
@@ -93,6 +95,68 @@ func (c *context) WithName(name string) Context {
 	}
 }
 
+// maxValueDepth limits how deeply nested maps and slices are preserved.
+const maxValueDepth = 8
+
+// basicValue keeps strings, booleans, numbers, durations, byte sizes, and
+// times as-is so that formatters can render them with their native types.
+// Maps with string keys become Fields and slices become []interface{}, with
+// their elements converted in turn.  Errors are stored as their messages and
+// everything else is converted with fmt.Sprint.
 func basicValue(value interface{}) interface{} {
+	return basicValueDepth(value, 0)
+}
+
+func basicValueDepth(value interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string, bool, time.Time, time.Duration, ByteSize,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v
+	case error:
+		if isNilPointer(v) {
+			return fmt.Sprint(v)
+		}
+		return v.Error()
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return fmt.Sprint(v)
+		}
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String || depth >= maxValueDepth {
+			break
+		}
+		fields := make(Fields, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			fields[iter.Key().String()] = basicValueDepth(iter.Value().Interface(), depth+1)
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 || depth >= maxValueDepth {
+			break
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = basicValueDepth(rv.Index(i).Interface(), depth+1)
+		}
+		return list
+	}
 	return fmt.Sprint(value)
 }
+
+// isNilPointer reports whether value holds a nil pointer.  Calling methods
+// such as Error or String on one may panic, whereas fmt.Sprint recovers and
+// renders "<nil>".
+func isNilPointer(value interface{}) bool {
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+const (
+	crashDumpKey      = "crash_dump"
+	crashDumpErrorKey = "crash_dump_error"
+	crashTimeFormat   = "20060102T150405.000000000"
+	maxStackDumpSize  = 64 << 20
+)
+
+// SetCrashDir enables crash reports for FATAL events, including recovered
+// panics.  Each report contains the event, the stacks of all goroutines,
+// runtime memory statistics, and build information.  Reports are written
+// atomically to dir, and the event's Context receives a "crash_dump" field
+// with the report's path.  Passing an empty dir disables crash reports.
+func SetCrashDir(dir string) {
+	RootLogger.crashDir = dir
+}
+
+// withCrashDump writes a crash report for the event and returns the event's
+// context extended with a reference to the report.
+func withCrashDump(dir string, event *Event) Context {
+	name := fmt.Sprintf("crash-%s-%d.txt", event.Time.UTC().Format(crashTimeFormat), os.Getpid())
+	path, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return event.Context.WithField(crashDumpErrorKey, err)
+	}
+
+	// Reference the report before writing it so the report's copy of the
+	// event matches what collectors receive.
+	dumped := *event
+	dumped.Context = event.Context.WithField(crashDumpKey, path)
+	if err := writeCrashDump(path, &dumped); err != nil {
+		return event.Context.WithField(crashDumpErrorKey, err)
+	}
+	return dumped.Context
+}
+
+// writeCrashDump writes the report to a temporary file in the destination
+// directory and renames it into place, so readers never see a partial dump.
+func writeCrashDump(path string, event *Event) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".crash-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	writeCrashEvent(w, event)
+	writeCrashMemStats(w)
+	writeCrashBuildInfo(w)
+	writeCrashGoroutines(w)
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeCrashEvent(w io.Writer, event *Event) {
+	fmt.Fprintf(w, "=== Event ===\n")
+	fmt.Fprintf(w, "Time:    %s\n", event.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Level:   %s\n", event.Level)
+	fmt.Fprintf(w, "Logger:  %s\n", event.Context.Name())
+	fmt.Fprintf(w, "Message: %s\n", event.Message)
+	if event.Error != nil {
+		fmt.Fprintf(w, "Error:   %v (%T)\n", event.Error, event.Error)
+	}
+
+	fields := event.Context.Fields()
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "Context:\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "\t%s=%v\n", k, fields[k])
+	}
+
+	fmt.Fprintf(w, "Stack:\n")
+	for _, frame := range event.Stack() {
+		fmt.Fprintf(w, "\t%s.%s\n\t\t%s:%d\n", frame.Package(), frame.Function(), frame.File(), frame.Line())
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func writeCrashMemStats(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	fmt.Fprintf(w, "=== Runtime ===\n")
+	fmt.Fprintf(w, "Goroutines:   %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "GOMAXPROCS:   %d\n", runtime.GOMAXPROCS(0))
+	fmt.Fprintf(w, "Alloc:        %d\n", stats.Alloc)
+	fmt.Fprintf(w, "TotalAlloc:   %d\n", stats.TotalAlloc)
+	fmt.Fprintf(w, "Sys:          %d\n", stats.Sys)
+	fmt.Fprintf(w, "HeapAlloc:    %d\n", stats.HeapAlloc)
+	fmt.Fprintf(w, "HeapInuse:    %d\n", stats.HeapInuse)
+	fmt.Fprintf(w, "HeapObjects:  %d\n", stats.HeapObjects)
+	fmt.Fprintf(w, "StackInuse:   %d\n", stats.StackInuse)
+	fmt.Fprintf(w, "NumGC:        %d\n", stats.NumGC)
+	fmt.Fprintf(w, "PauseTotalNs: %d\n", stats.PauseTotalNs)
+	fmt.Fprintf(w, "\n")
+}
+
+func writeCrashBuildInfo(w io.Writer) {
+	fmt.Fprintf(w, "=== Build ===\n")
+	fmt.Fprintf(w, "Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(w, "%s", info)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func writeCrashGoroutines(w io.Writer) {
+	fmt.Fprintf(w, "=== Goroutines ===\n")
+	w.Write(allStacks())
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until
+// runtime.Stack no longer fills it.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDumpSize {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fatalWithCrashDir logs a FATAL event with crash reports written to dir
+// and returns the delivered event.
+func fatalWithCrashDir(t *testing.T, dir string) *Event {
+	t.Helper()
+	SetExitHook(func(code int) {})
+	defer SetExitHook(nil)
+
+	l := newLogger()
+	l.crashDir = dir
+	r := &recorder{}
+	l.collect(FATAL, r)
+	l.WithName("db").Fatal("crashed")
+
+	events := r.recordedEvents()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events", len(events))
+	}
+	return events[0]
+}
+
+func TestCrashDump(t *testing.T) {
+	dir := t.TempDir()
+	event := fatalWithCrashDir(t, dir)
+
+	path, _ := event.Context.Fields()[crashDumpKey].(string)
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "crash-") {
+		t.Fatalf("expected the event to reference a report in %s, got %q", dir, path)
+	}
+	// Only the renamed report remains, with no temporary files.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+		t.Errorf("expected only the report in %s, got %v", dir, entries)
+	}
+
+	report, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Level:   FATAL\n",
+		"Logger:  db\n",
+		"Message: crashed\n",
+		"\t" + crashDumpKey + "=" + path + "\n",
+		"=== Runtime ===",
+		"=== Build ===",
+		"=== Goroutines ===\ngoroutine ",
+	} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("expected the report to contain %q", want)
+		}
+	}
+}
+
+func TestCrashDumpError(t *testing.T) {
+	event := fatalWithCrashDir(t, filepath.Join(t.TempDir(), "missing"))
+
+	fields := event.Context.Fields()
+	if _, ok := fields[crashDumpKey]; ok {
+		t.Error("expected no report reference when the report can't be written")
+	}
+	if _, ok := fields[crashDumpErrorKey]; !ok {
+		t.Error("expected the event to record the report error")
+	}
+}
+
+func TestCrashDumpAtomic(t *testing.T) {
+	// A directory in the report's place makes the final rename fail.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report")
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	event := &Event{Time: time.Now(), Level: FATAL, Context: EmptyContext, Message: "crashed"}
+	if err := writeCrashDump(path, event); err == nil {
+		t.Fatal("expected the rename to fail")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "report" {
+		t.Errorf("expected the temporary report to be removed, got %v", entries)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ecsVersion = "8.11.0"
+	ecsLabels  = "labels"
+)
+
+// FormatECS renders events as Elastic Common Schema JSON documents using
+// the default ECS options.
+var FormatECS = ECS{}.Formatter()
+
+// ECS configures a formatter that renders events as single-line Elastic
+// Common Schema (ECS) JSON documents.  The event time is sent as
+// @timestamp, the level, logger name, and source location under log, the
+// error under error, and the local hostname under host.  Context fields are
+// nested under Namespace.  ECS requires labels, the default namespace, to
+// hold flat keyword values, so fields written there are converted to
+// strings and nested fields are flattened into keys joined by underscores.
+// Other namespaces keep the fields' types and structure.
+type ECS struct {
+	Namespace string // Default: "labels"
+}
+
+// Formatter returns a Formatter that renders ECS documents as configured.
+func (e ECS) Formatter() Formatter {
+	if e.Namespace == "" {
+		e.Namespace = ecsLabels
+	}
+	hostname, fqdn := host(false), host(true)
+
+	return func(buffer Buffer, event *Event) {
+		if hostname == "" {
+			hostname, fqdn = host(false), host(true)
+		}
+
+		doc := jsonObject{buffer: buffer}
+		doc.begin()
+		doc.key("@timestamp")
+		buffer.WriteByte('"')
+		buffer.AppendTime(event.Time.UTC(), time.RFC3339Nano)
+		buffer.WriteByte('"')
+		doc.key("message")
+		writeJSONString(buffer, event.Message)
+
+		doc.key("log")
+		logObj := jsonObject{buffer: buffer}
+		logObj.begin()
+		logObj.key("level")
+		writeJSONString(buffer, strings.ToLower(event.Level.String()))
+		if name := event.Context.Name(); name != "" {
+			logObj.key("logger")
+			writeJSONString(buffer, name)
+		}
+		if event.HasFrames() {
+			logObj.key("origin")
+			writeECSOrigin(buffer, event.Source())
+		}
+		logObj.end()
+
+		if event.Error != nil {
+			doc.key("error")
+			writeECSError(buffer, event)
+		}
+
+		if hostname != "" {
+			doc.key("host")
+			hostObj := jsonObject{buffer: buffer}
+			hostObj.begin()
+			hostObj.key("hostname")
+			writeJSONString(buffer, hostname)
+			hostObj.key("name")
+			writeJSONString(buffer, fqdn)
+			hostObj.end()
+		}
+
+		if event.Context.NumFields() > 0 {
+			doc.key(e.Namespace)
+			if e.Namespace == ecsLabels {
+				writeECSLabels(buffer, event.Context.Fields())
+			} else {
+				writeJSONFields(buffer, event.Context.Fields())
+			}
+		}
+
+		doc.key("ecs")
+		ecsObj := jsonObject{buffer: buffer}
+		ecsObj.begin()
+		ecsObj.key("version")
+		writeJSONString(buffer, ecsVersion)
+		ecsObj.end()
+		doc.end()
+	}
+}
+
+func writeECSOrigin(buffer Buffer, frame *Frame) {
+	origin := jsonObject{buffer: buffer}
+	origin.begin()
+	origin.key("file")
+	file := jsonObject{buffer: buffer}
+	file.begin()
+	file.key("name")
+	writeJSONString(buffer, frame.File())
+	file.key("line")
+	buffer.AppendInt(int64(frame.Line()))
+	file.end()
+	origin.key("function")
+	writeJSONString(buffer, frame.Package()+"."+frame.Function())
+	origin.end()
+}
+
+func writeECSError(buffer Buffer, event *Event) {
+	obj := jsonObject{buffer: buffer}
+	obj.begin()
+	obj.key("type")
+	writeJSONString(buffer, event.ErrorType())
+	obj.key("message")
+	writeJSONString(buffer, event.Error.Error())
+	if event.HasFrames() {
+		trace := NewBuffer()
+		defer ReleaseBuffer(trace)
+		FormatStack(trace, event)
+		obj.key("stack_trace")
+		writeJSONString(buffer, string(trace.Bytes()))
+	}
+	obj.end()
+}
+
+// ecsLabelKeys replaces the characters that Elastic's agents reject in label
+// keys.  Dots would otherwise be mapped as objects by Elasticsearch.
+var ecsLabelKeys = strings.NewReplacer(".", "_", "*", "_", `"`, "_")
+
+// writeECSLabels writes fields as a flat object of strings.
+func writeECSLabels(buffer Buffer, fields Fields) {
+	labels := make(map[string]string)
+	flattenECSLabels(labels, "", fields)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	obj := jsonObject{buffer: buffer}
+	obj.begin()
+	for _, k := range keys {
+		obj.key(k)
+		writeJSONString(buffer, labels[k])
+	}
+	obj.end()
+}
+
+// flattenECSLabels adds the fields to labels with prefix.  Keys are visited
+// in sorted order and the first of any clashing keys is kept.  Nil values
+// are omitted.
+func flattenECSLabels(labels map[string]string, prefix string, fields Fields) {
+	for _, k := range sortedFieldKeys(fields) {
+		key := prefix + ecsLabelKeys.Replace(k)
+		switch v := fields[k].(type) {
+		case nil:
+		case Fields:
+			flattenECSLabels(labels, key+"_", v)
+		default:
+			if _, clash := labels[key]; !clash {
+				labels[key] = ecsLabelValue(v)
+			}
+		}
+	}
+}
+
+func ecsLabelValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []interface{}:
+		buffer := NewBuffer()
+		defer ReleaseBuffer(buffer)
+		writeJSONValue(buffer, v)
+		return string(buffer.Bytes())
+	}
+	return fieldString(v)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestECSNamespace(t *testing.T) {
+	event := &Event{
+		Time:  time.Unix(1700000000, 0),
+		Level: INFO,
+		Context: EmptyContext.With(Fields{
+			"user":        "bob",
+			"attempt":     3,
+			"ok":          true,
+			"size":        ByteSize(2048),
+			"elapsed":     1500 * time.Millisecond,
+			"at":          time.Unix(1600000000, 0),
+			"tags":        []interface{}{"a", 1},
+			"http":        Fields{"status": 200, "route": Fields{"name": "login"}},
+			"http.method": "GET",
+			"missing":     nil,
+		}),
+		Message: "login",
+	}
+
+	var labels struct{ Labels map[string]string }
+	if err := json.Unmarshal(Render(FormatECS, event), &labels); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"user":            "bob",
+		"attempt":         "3",
+		"ok":              "true",
+		"size":            "2048",
+		"elapsed":         "1.5s",
+		"at":              "2020-09-13T12:26:40Z",
+		"tags":            `["a",1]`,
+		"http_status":     "200",
+		"http_route_name": "login",
+		"http_method":     "GET",
+	}
+	if !reflect.DeepEqual(labels.Labels, want) {
+		t.Errorf("labels are %v, want %v", labels.Labels, want)
+	}
+
+	var custom struct{ App map[string]interface{} }
+	if err := json.Unmarshal(Render(ECS{Namespace: "app"}.Formatter(), event), &custom); err != nil {
+		t.Fatal(err)
+	}
+	if custom.App["attempt"] != 3.0 || custom.App["http"].(map[string]interface{})["status"] != 200.0 {
+		t.Errorf("expected a custom namespace to keep types and nesting, got %v", custom.App)
+	}
+}
@@ -21,9 +21,37 @@
 package main
 
 import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxFrames limits the depth of the call stacks captured for events.
+const maxFrames = 64
+
+// LogFielder is implemented by errors that carry structured data, such as
+// the IDs of the objects involved or whether the failure is retryable.  When
+// an event's Error, or any error it wraps, implements LogFielder, the
+// returned fields are merged into the event's Context at dispatch time.
+// Wrapped errors are found through both forms of Unwrap, so errors combined
+// with errors.Join or several %w verbs are included.  Fields from outer
+// errors take precedence over those from wrapped errors, and earlier joined
+// errors over later ones.
+type LogFielder interface {
+	LogFields() Fields
+}
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return &Event{}
+	},
+}
+
+// Event is a single logged event.  Events are pooled: a collector must not
+// retain an event, or anything referencing it, after Collect returns.  Use
+// Clone to keep a copy.
 type Event struct {
 	Time    time.Time
 	Level   Level
@@ -31,6 +59,35 @@ type Event struct {
 	Frames  []uintptr
 	Error   error
 	Message string
+
+	// stack holds the frames of events decoded from an encoded form, which
+	// have no return addresses.
+	stack []*Frame
+
+	// refs counts the workers that have yet to collect the event.  The event
+	// returns to the pool when the count drops to zero.
+	refs int32
+}
+
+func getEvent() *Event {
+	return eventPool.Get().(*Event)
+}
+
+// retain adds count references to the event.
+func (e *Event) retain(count int) {
+	atomic.AddInt32(&e.refs, int32(count))
+}
+
+// release drops a reference to the event, returning it to the pool once
+// every holder has released it.
+func (e *Event) release() {
+	if atomic.AddInt32(&e.refs, -1) != 0 {
+		return
+	}
+	// Keep the frames' capacity so the next event can capture its stack
+	// without allocating.
+	*e = Event{Frames: e.Frames[:0]}
+	eventPool.Put(e)
 }
 
 func (e *Event) Clone() *Event {
@@ -43,25 +100,133 @@ func (e *Event) Clone() *Event {
 		Frames:  frames,
 		Error:   e.Error,
 		Message: e.Message,
+		stack:   e.stack,
 	}
 }
 
+// ErrorType returns the type name of the event's Error, such as
+// "*os.PathError", or an empty string if the event has no error.
 func (e *Event) ErrorType() string {
-	return ""
+	if e.Error == nil {
+		return ""
+	}
+	return reflect.TypeOf(e.Error).String()
+}
+
+// HasFrames reports whether the event has any stack frames, whether
+// captured when the event was generated or decoded from an encoded event.
+func (e *Event) HasFrames() bool {
+	return len(e.Frames) > 0 || len(e.stack) > 0
 }
 
+// Source returns the frame where the event was generated, or nil if no
+// frames were captured.
 func (e *Event) Source() *Frame {
-	return nil
+	if len(e.Frames) == 0 {
+		if len(e.stack) > 0 {
+			return e.stack[0]
+		}
+		return nilFrame
+	}
+	return frameForPC(e.Frames[0])
 }
 
+// source is like Source, but returns the frame by value so that formatters
+// can read it without allocating.
+func (e *Event) source() Frame {
+	switch {
+	case len(e.Frames) > 0:
+		return frameAt(e.Frames[0])
+	case len(e.stack) > 0:
+		return *e.stack[0]
+	}
+	return Frame{}
+}
+
+// Stack returns the full call stack captured for the event, starting at the
+// frame where the event was generated.
 func (e *Event) Stack() []*Frame {
-	return nil
+	if len(e.Frames) == 0 && len(e.stack) > 0 {
+		return append([]*Frame(nil), e.stack...)
+	}
+	stack := make([]*Frame, len(e.Frames))
+	for i, pc := range e.Frames {
+		stack[i] = frameForPC(pc)
+	}
+	return stack
 }
 
+// withErrorFields returns context extended with the fields supplied by err
+// and its wrapped errors.  The fielders are applied in reverse so that fields
+// from outer and earlier errors win when keys collide.
+func withErrorFields(context Context, err error) Context {
+	fielders := appendFielders(nil, err)
+	for i := len(fielders) - 1; i >= 0; i-- {
+		context = context.With(fielders[i].LogFields())
+	}
+	return context
+}
+
+// appendFielders appends the LogFielders in err's tree in the order that
+// errors.Is visits them: each error before the errors it wraps, and joined
+// errors in order.
+func appendFielders(fielders []LogFielder, err error) []LogFielder {
+	for err != nil {
+		if fielder, ok := err.(LogFielder); ok {
+			fielders = append(fielders, fielder)
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, wrapped := range x.Unwrap() {
+				fielders = appendFielders(fielders, wrapped)
+			}
+			return fielders
+		default:
+			return fielders
+		}
+	}
+	return fielders
+}
+
+// getRecoveryFrames is like getFrames, but is meant to be called from a
+// deferred recovery.  The returned frames start where the panic was raised
+// rather than at the deferred call.
 func getRecoveryFrames(skip int, depth int) []uintptr {
-	return nil
+	frames := getFrames(skip+1, depth+maxFrames)
+	for i, pc := range frames {
+		fn := runtime.FuncForPC(pc - 1)
+		if fn != nil && fn.Name() == "runtime.gopanic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+	// Runtime errors such as nil dereferences are raised from within the
+	// runtime package.  Skip those frames so the stack starts in user code.
+	for len(frames) > 1 && frameForPC(frames[0]).Package() == "runtime" {
+		frames = frames[1:]
+	}
+	if len(frames) > depth {
+		frames = frames[:depth]
+	}
+	return frames
 }
 
+// getFrames returns up to depth return addresses from the calling
+// goroutine's stack, skipping the given number of frames above the caller
+// of getFrames.
 func getFrames(skip int, depth int) []uintptr {
-	return nil
+	return fillFrames(nil, skip+1, depth)
+}
+
+// fillFrames is like getFrames, but reuses the capacity of frames when it
+// can hold depth addresses.
+func fillFrames(frames []uintptr, skip int, depth int) []uintptr {
+	if cap(frames) < depth {
+		frames = make([]uintptr, depth)
+	}
+	// Skip runtime.Callers and fillFrames itself
+	count := runtime.Callers(skip+2, frames[:depth])
+	return frames[:count]
 }
@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fieldError is an error that supplies fields for the event's context.
+type fieldError struct {
+	msg    string
+	fields Fields
+}
+
+func (e fieldError) Error() string     { return e.msg }
+func (e fieldError) LogFields() Fields { return e.fields }
+
+// wrappedFieldError supplies fields and wraps another error.
+type wrappedFieldError struct {
+	fieldError
+	wrapped error
+}
+
+func (e wrappedFieldError) Unwrap() error { return e.wrapped }
+
+func TestErrorFields(t *testing.T) {
+	inner := fieldError{"inner", Fields{"id": "inner", "inner": true}}
+	outer := fieldError{"outer", Fields{"id": "outer", "outer": true}}
+	first := fieldError{"first", Fields{"id": "first", "first": true}}
+	second := fieldError{"second", Fields{"id": "second", "second": true}}
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		want Fields
+	}{
+		{"nil", nil, Fields{}},
+		{"plain", errors.New("plain"), Fields{}},
+		{"direct", inner, Fields{"id": "inner", "inner": true}},
+		{"wrapped", fmt.Errorf("context: %w", inner), Fields{"id": "inner", "inner": true}},
+		{"outer wins", fmt.Errorf("%w: %w", outer, inner),
+			Fields{"id": "outer", "outer": true, "inner": true}},
+		{"wrapped twice", fmt.Errorf("a: %w", fmt.Errorf("b: %w", inner)), Fields{"id": "inner", "inner": true}},
+		{"joined", errors.Join(errors.New("plain"), inner), Fields{"id": "inner", "inner": true}},
+		{"earlier joined wins", errors.Join(first, second),
+			Fields{"id": "first", "first": true, "second": true}},
+		{"joined in wrapped", fmt.Errorf("context: %w", errors.Join(first, fmt.Errorf("b: %w", second))),
+			Fields{"id": "first", "first": true, "second": true}},
+		{"wrapper over joined", wrappedFieldError{outer, errors.Join(first, second)},
+			Fields{"id": "outer", "outer": true, "first": true, "second": true}},
+	} {
+		got := withErrorFields(EmptyContext, tt.err).Fields()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
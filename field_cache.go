@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import "sync/atomic"
+
+// maxEventFields limits how many fields an event may add to its logger's
+// context and still use the cached rendering of the logger's fields.  Events
+// with more render their whole context.
+const maxEventFields = 8
+
+// fieldEncoder renders context fields as a sequence of members, so that the
+// members for a logger's fields can be cached and followed by the members
+// for fields added per event.
+type fieldEncoder interface {
+	begin(buffer Buffer)
+	end(buffer Buffer)
+	separator(buffer Buffer)
+	member(buffer Buffer, key string, value interface{})
+
+	// keys returns the keys of fields in rendering order.
+	keys(fields Fields) []string
+
+	// leading reports whether the key is rendered ahead of the others, and
+	// so can't follow cached members.
+	leading(key string) bool
+}
+
+// writeFields renders every field of the context.
+func writeFields(enc fieldEncoder, buffer Buffer, ctx Context) {
+	enc.begin(buffer)
+	if ctx.NumFields() > 0 {
+		writeMembers(enc, buffer, ctx.Fields())
+	}
+	enc.end(buffer)
+}
+
+func writeMembers(enc fieldEncoder, buffer Buffer, fields Fields) {
+	for i, k := range enc.keys(fields) {
+		if i > 0 {
+			enc.separator(buffer)
+		}
+		enc.member(buffer, k, fields[k])
+	}
+}
+
+// contextFormatters counts the formatters returned by cacheFields, to give
+// each a unique id.
+var contextFormatters uint32
+
+// cacheFields returns a formatter that renders the event's context with enc.
+// The members for the fields of the event's Logger are rendered once and
+// cached on the logger's context.  Fields added per event, such as template
+// values, are rendered after the cached members.  Events whose fields
+// replace a logger field or lead the ordering render the whole context.
+func cacheFields(enc fieldEncoder) Formatter {
+	id := atomic.AddUint32(&contextFormatters, 1)
+	return func(buffer Buffer, event *Event) {
+		c, ok := event.Context.(*context)
+		if !ok {
+			writeFields(enc, buffer, event.Context)
+			return
+		}
+
+		// Collect the fields added since the logger's context, newest first
+		var added [maxEventFields]*fieldList
+		n := 0
+		static := c.fieldList
+		for ; static != nil && !static.isStatic(); static = static.parent {
+			if n == len(added) {
+				writeFields(enc, buffer, event.Context)
+				return
+			}
+			added[n] = static
+			n++
+		}
+		if static == nil {
+			writeFields(enc, buffer, event.Context)
+			return
+		}
+		for _, field := range added[:n] {
+			if enc.leading(field.key) || static.has(field.key) {
+				writeFields(enc, buffer, event.Context)
+				return
+			}
+		}
+
+		// Insertion sort is stable, so the newest field comes first among
+		// those with the same key.
+		for i := 1; i < n; i++ {
+			for j := i; j > 0 && added[j].key < added[j-1].key; j-- {
+				added[j], added[j-1] = added[j-1], added[j]
+			}
+		}
+
+		enc.begin(buffer)
+		if encoded, ok := static.encoding(id); ok {
+			buffer.Write(encoded)
+		} else {
+			start := buffer.Len()
+			writeMembers(enc, buffer, static.Fields())
+			static.storeEncoding(id, buffer.Bytes()[start:])
+		}
+		for i, field := range added[:n] {
+			if i > 0 && field.key == added[i-1].key {
+				continue
+			}
+			enc.separator(buffer)
+			enc.member(buffer, field.key, field.value)
+		}
+		enc.end(buffer)
+	}
+}
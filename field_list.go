@@ -20,10 +20,34 @@
 
 package main
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 type fieldList struct {
 	parent *fieldList
 	key    string
 	value  interface{}
+
+	// static is set once the list is held by a Logger, and so is shared by
+	// many events.  Only static lists have their renderings cached.
+	static uint32
+
+	// encodings caches the renderings of the list by context formatters.  It
+	// holds a []fieldEncoding that is replaced, never modified, under mu.
+	encodings atomic.Value
+	mu        sync.Mutex
+
+	// fields caches the Fields of a static list.
+	fields atomic.Value
+}
+
+// fieldEncoding is the rendering of a field list by the context formatter
+// with the given id.
+type fieldEncoding struct {
+	formatter uint32
+	encoded   []byte
 }
 
 func (p *fieldList) append(key string, value interface{}) *fieldList {
@@ -35,14 +59,14 @@ func (p *fieldList) append(key string, value interface{}) *fieldList {
 }
 
 func (p *fieldList) Each(fn func(key string, value interface{})) {
-	for current := p; current != nil; current = p.parent {
+	for current := p; current != nil; current = current.parent {
 		fn(current.key, current.value)
 	}
 }
 
 func (p *fieldList) NumFields() int {
 	count := 0
-	for current := p; current != nil; current = p.parent {
+	for current := p; current != nil; current = current.parent {
 		count++
 	}
 	return count
@@ -56,3 +80,52 @@ func (p *fieldList) Fields() Fields {
 	fields[p.key] = p.value
 	return fields
 }
+
+// encoding returns the cached rendering of the list by the given context
+// formatter.
+func (p *fieldList) encoding(formatter uint32) ([]byte, bool) {
+	encodings, _ := p.encodings.Load().([]fieldEncoding)
+	for _, e := range encodings {
+		if e.formatter == formatter {
+			return e.encoded, true
+		}
+	}
+	return nil, false
+}
+
+// storeEncoding caches a copy of the list's rendering by the given context
+// formatter.
+func (p *fieldList) storeEncoding(formatter uint32, encoded []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.encoding(formatter); ok {
+		return
+	}
+	old, _ := p.encodings.Load().([]fieldEncoding)
+	encodings := make([]fieldEncoding, len(old), len(old)+1)
+	copy(encodings, old)
+	encodings = append(encodings, fieldEncoding{
+		formatter: formatter,
+		encoded:   append([]byte(nil), encoded...),
+	})
+	p.encodings.Store(encodings)
+}
+
+func (p *fieldList) markStatic() {
+	atomic.StoreUint32(&p.static, 1)
+}
+
+func (p *fieldList) isStatic() bool {
+	return atomic.LoadUint32(&p.static) == 1
+}
+
+// has reports whether a static list has a field with the given key.
+func (p *fieldList) has(key string) bool {
+	fields, ok := p.fields.Load().(Fields)
+	if !ok {
+		fields = p.Fields()
+		p.fields.Store(fields)
+	}
+	_, ok = fields[key]
+	return ok
+}
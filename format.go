@@ -21,7 +21,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
@@ -31,14 +30,6 @@ import (
 	"unicode"
 )
 
-const (
-	none   = 0
-	red    = 31
-	green  = 32
-	yellow = 33
-	blue   = 34
-)
-
 var (
 	HumanSource        = FormatFormatter("%v:%v", FormatShortFile, FormatLine)
 	HumanMessage       = Join(" ", FormatMessage, FormatHumanContext)
@@ -57,31 +48,46 @@ func Render(formatter Formatter, event *Event) []byte {
 	return buffer.Bytes()
 }
 
+// Join renders the formatters in order, separating non-empty outputs with
+// sep.  Formatters that write nothing, such as conditional formatters that
+// don't apply to the event, don't produce a separator.
 func Join(sep string, formatters ...Formatter) Formatter {
 	return func(buffer Buffer, event *Event) {
-		for i, formatter := range formatters {
+		wrote := false
+		for _, formatter := range formatters {
 			origlen := buffer.Len()
-			formatter(buffer, event)
-			if buffer.Len() > origlen && i < len(formatters)-1 {
+			if wrote {
 				buffer.WriteString(sep)
 			}
+			seplen := buffer.Len()
+			formatter(buffer, event)
+			if buffer.Len() == seplen {
+				buffer.Truncate(origlen)
+				continue
+			}
+			wrote = true
 		}
 	}
 }
 
+// FormatFormatter renders the format string, replacing each %v verb with the
+// output of the next formatter, in order.  Verbs may include fmt-style width,
+// precision, and alignment flags: %5v right-aligns to at least 5 characters,
+// %-5v left-aligns, and %.100v truncates to at most 100 characters.  A
+// literal percent sign is written as %%.
 func FormatFormatter(format string, formatters ...Formatter) Formatter {
 	formatterIdx := 0
 	segments := splitFormat(format)
 	chain := make([]Formatter, len(segments))
 	for i, seg := range segments {
 		switch {
-		case seg == "%v" && formatterIdx < len(formatters):
-			chain[i] = formatters[formatterIdx]
+		case seg.verb && formatterIdx < len(formatters):
+			chain[i] = seg.wrap(formatters[formatterIdx])
 			formatterIdx++
-		case seg == "%v":
+		case seg.verb:
 			chain[i] = Literal("%!v(MISSING)")
 		default:
-			chain[i] = Literal(seg)
+			chain[i] = Literal(seg.literal)
 		}
 	}
 
@@ -92,58 +98,92 @@ func FormatFormatter(format string, formatters ...Formatter) Formatter {
 	}
 }
 
-func splitFormat(format string) []string {
+// formatSegment is either a literal string or a %v verb with its flags.
+type formatSegment struct {
+	literal   string
+	verb      bool
+	width     int
+	leftAlign bool
+	precision int
+}
+
+func (seg formatSegment) wrap(formatter Formatter) Formatter {
+	if seg.precision >= 0 {
+		formatter = Truncate(seg.precision, formatter)
+	}
+	if seg.width > 0 {
+		width := seg.width
+		if seg.leftAlign {
+			width = -width
+		}
+		formatter = Pad(width, formatter)
+	}
+	return formatter
+}
+
+func splitFormat(format string) []formatSegment {
 	var (
-		segments []string
-		segstart int
-		lastrune rune
+		segments []formatSegment
+		literal  []byte
 	)
 
-	runes := []rune(format)
-	for i, r := range runes {
-		switch {
-		case lastrune == '%' && r == '%':
-			lastrune = 0
-		case lastrune == '%' && r == 'v':
-			segend := i - 1
-			if segstart != segend {
-				segments = append(segments, string(runes[segstart:segend]))
-			}
-			segments = append(segments, "%v")
-			segstart = i + 1
-			lastrune = r
-		default:
-			lastrune = r
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			literal = append(literal, '%')
+			i++
+			continue
+		}
+
+		verb, end, ok := parseVerb(format, i+1)
+		if !ok {
+			literal = append(literal, '%')
+			continue
+		}
+		if len(literal) > 0 {
+			segments = append(segments, formatSegment{literal: string(literal)})
+			literal = literal[:0]
 		}
+		segments = append(segments, verb)
+		i = end
 	}
 
-	if segstart < len(runes) {
-		segments = append(segments, string(runes[segstart:]))
+	if len(literal) > 0 {
+		segments = append(segments, formatSegment{literal: string(literal)})
 	}
 	return segments
 }
 
-func Colorize(formatter Formatter) Formatter {
-	return func(buffer Buffer, event *Event) {
-		buffer.WriteString(fmt.Sprintf("\x1b[%dm", colorFor(event.Level)))
-		formatter(buffer, event)
-		buffer.WriteString("\x1b[0m")
-	}
-}
-
-func colorFor(lvl Level) int {
-	switch lvl {
-	case DEBUG:
-		return blue
-	case INFO:
-		return green
-	case WARN:
-		return yellow
-	case ERROR, FATAL:
-		return red
-	default:
-		return none
+// parseVerb parses the flags, width, and precision of a verb starting at
+// format[start], just past the percent sign.  It returns the index of the
+// terminating 'v', or ok=false if the text isn't a valid %v verb.
+func parseVerb(format string, start int) (seg formatSegment, end int, ok bool) {
+	seg = formatSegment{verb: true, precision: -1}
+	i := start
+	if i < len(format) && format[i] == '-' {
+		seg.leftAlign = true
+		i++
+	}
+	seg.width, i = parseNum(format, i)
+	if i < len(format) && format[i] == '.' {
+		seg.precision, i = parseNum(format, i+1)
 	}
+	if i >= len(format) || format[i] != 'v' {
+		return formatSegment{}, 0, false
+	}
+	return seg, i, true
+}
+
+func parseNum(s string, start int) (num int, end int) {
+	end = start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		num = num*10 + int(s[end]-'0')
+		end++
+	}
+	return
 }
 
 func HostFormatter() Formatter {
@@ -194,7 +234,7 @@ func Literal(s string) Formatter {
 
 func TimeFormatter(timeFormat string) Formatter {
 	return func(buffer Buffer, event *Event) {
-		buffer.WriteString(event.Time.Format(timeFormat))
+		buffer.AppendTime(event.Time, timeFormat)
 	}
 }
 
@@ -203,15 +243,18 @@ func FormatLevel(buffer Buffer, event *Event) {
 }
 
 func FormatPackage(buffer Buffer, event *Event) {
-	buffer.WriteString(event.Source().Package())
+	frame := event.source()
+	buffer.WriteString(frame.Package())
 }
 
 func FormatFile(buffer Buffer, event *Event) {
-	buffer.WriteString(event.Source().File())
+	frame := event.source()
+	buffer.WriteString(frame.File())
 }
 
 func FormatShortFile(buffer Buffer, event *Event) {
-	short := event.Source().File()
+	frame := event.source()
+	short := frame.File()
 	idx := strings.LastIndex(short, "/")
 	if idx != -1 {
 		short = short[idx+1:]
@@ -220,7 +263,8 @@ func FormatShortFile(buffer Buffer, event *Event) {
 }
 
 func FormatLine(buffer Buffer, event *Event) {
-	buffer.WriteString(fmt.Sprintf("%d", event.Source().Line()))
+	frame := event.source()
+	buffer.AppendInt(int64(frame.Line()))
 }
 
 func FormatRawMessage(buffer Buffer, event *Event) {
@@ -235,7 +279,7 @@ func FormatAsciiMessage(buffer Buffer, event *Event) {
 
 func FormatMessage(buffer Buffer, event *Event) {
 	trimmed := strings.TrimSpace(event.Message)
-	for _, r := range []rune(trimmed) {
+	for _, r := range trimmed {
 		switch {
 		case r == ' ':
 			buffer.WriteRune(r)
@@ -248,55 +292,242 @@ func FormatMessage(buffer Buffer, event *Event) {
 	}
 }
 
+// FormatHumanContext renders the context fields as space-separated key=value
+// pairs using the default HumanContext options.
 func FormatHumanContext(buffer Buffer, event *Event) {
-	fields := event.Context.Fields()
+	formatHumanContext(buffer, event)
+}
 
-	// Sort field keys for predictable output ordering
-	var sortedKeys []string
-	for k := range fields {
-		sortedKeys = append(sortedKeys, k)
+var formatHumanContext = HumanContext{}.Formatter()
+
+// HumanContext configures a formatter that renders the context fields as
+// space-separated key=value pairs.  Fields are sorted by key, except for
+// PriorityKeys, which are rendered first and in the order given.  Nested
+// maps are flattened into dotted keys and slices are rendered as bracketed
+// lists.  Durations are rounded for readability and ByteSize values are
+// rendered with binary unit suffixes.  The rendering of each logger's
+// context is cached, and fields added per event follow it in sorted order.
+type HumanContext struct {
+	PriorityKeys []string // Top-level keys to render first, when present
+}
+
+// Formatter returns a Formatter that renders context fields as configured.
+func (h HumanContext) Formatter() Formatter {
+	return cacheFields(humanContext{priority: h.PriorityKeys, sep: " ", writeKey: writeHumanKey})
+}
+
+// humanContext renders context fields, separating the key=value pairs with
+// sep and rendering keys with writeKey.
+type humanContext struct {
+	priority []string
+	sep      string
+	writeKey func(buffer Buffer, key string)
+}
+
+func (h humanContext) format(buffer Buffer, event *Event) {
+	writeFields(h, buffer, event.Context)
+}
+
+func (h humanContext) begin(buffer Buffer) {}
+
+func (h humanContext) end(buffer Buffer) {}
+
+func (h humanContext) separator(buffer Buffer) {
+	buffer.WriteString(h.sep)
+}
+
+// member writes a key=value pair, flattening nested Fields into dotted
+// keys.
+func (h humanContext) member(buffer Buffer, key string, value interface{}) {
+	if nested, ok := value.(Fields); ok && len(nested) > 0 {
+		for i, k := range sortedFieldKeys(nested) {
+			if i > 0 {
+				h.separator(buffer)
+			}
+			h.member(buffer, key+"."+k, nested[k])
+		}
+		return
 	}
-	sort.Strings(sortedKeys)
+	h.writeKey(buffer, key)
+	buffer.WriteByte('=')
+	writeHumanValue(buffer, value)
+}
 
-	for i, k := range sortedKeys {
-		buffer.WriteString(k)
-		buffer.WriteRune('=')
-		buffer.Write(humanValue(fields[k]))
-		if i < len(sortedKeys)-1 {
-			buffer.WriteRune(' ')
+func (h humanContext) keys(fields Fields) []string {
+	var keys []string
+	for _, k := range h.priority {
+		if _, ok := fields[k]; ok {
+			keys = append(keys, k)
 		}
 	}
+	return append(keys, sortedFieldKeys(fields, h.priority...)...)
 }
 
-func humanValue(v interface{}) []byte {
-	s, ok := v.(string)
-	if !ok {
-		s = fmt.Sprint(v)
+func (h humanContext) leading(key string) bool {
+	return containsString(h.priority, key)
+}
+
+// sortedFieldKeys returns the keys of fields in sorted order, omitting any
+// excluded keys.
+func sortedFieldKeys(fields Fields, exclude ...string) []string {
+	sortedKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		if !containsString(exclude, k) {
+			sortedKeys = append(sortedKeys, k)
+		}
 	}
-	return humanString(s)
+	sort.Strings(sortedKeys)
+	return sortedKeys
 }
 
-func humanString(s string) []byte {
-	special := func(r rune) bool {
-		switch {
-		case r == '"', r == '\'', r == '\\', r == 0:
-			return true
-		case unicode.IsLetter(r), unicode.IsNumber(r), unicode.IsPunct(r), unicode.IsSymbol(r):
-			return false
-		default:
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
 			return true
 		}
 	}
-	if strings.IndexFunc(s, special) >= 0 {
-		return []byte(strconv.Quote(s))
+	return false
+}
+
+func writeHumanKey(buffer Buffer, key string) {
+	buffer.WriteString(key)
+}
+
+func writeHumanValue(buffer Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		writeHumanString(buffer, v)
+	case bool:
+		buffer.AppendBool(v)
+	case int:
+		buffer.AppendInt(int64(v))
+	case int64:
+		buffer.AppendInt(v)
+	case uint:
+		buffer.AppendUint(uint64(v))
+	case uint64:
+		buffer.AppendUint(v)
+	case float64:
+		buffer.AppendFloat(v, 'g', -1, 64)
+	case time.Duration:
+		buffer.WriteString(humanDuration(v))
+	case ByteSize:
+		buffer.WriteString(v.String())
+	case []interface{}:
+		buffer.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buffer.WriteByte(' ')
+			}
+			writeHumanValue(buffer, elem)
+		}
+		buffer.WriteByte(']')
+	case Fields:
+		buffer.WriteByte('{')
+		for i, k := range sortedFieldKeys(v) {
+			if i > 0 {
+				buffer.WriteByte(' ')
+			}
+			writeHumanString(buffer, k)
+			buffer.WriteByte('=')
+			writeHumanValue(buffer, v[k])
+		}
+		buffer.WriteByte('}')
+	default:
+		writeHumanString(buffer, fmt.Sprint(v))
+	}
+}
+
+// humanDuration rounds durations to at most millisecond precision above a
+// second, and to whole seconds above a minute, since the full nanosecond
+// precision is rarely useful when reading logs.
+func humanDuration(d time.Duration) string {
+	abs := d
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs >= time.Minute:
+		d = d.Round(time.Second)
+	case abs >= time.Second:
+		d = d.Round(time.Millisecond)
+	case abs >= time.Millisecond:
+		d = d.Round(time.Microsecond)
 	}
-	return []byte(s)
+	return d.String()
 }
 
-func FormatJsonContext(buffer Buffer, event *Event) {
-	fields := event.Context.Fields()
-	marshaled, _ := json.Marshal(fields)
-	buffer.Write(marshaled)
+// ByteSize is a count of bytes.  ByteSize context values are rendered by
+// the human-readable and console formatters with binary unit suffixes, such
+// as 1.5MiB, and as plain integers by the machine-readable formatters.
+type ByteSize uint64
+
+var byteSizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+func (b ByteSize) String() string {
+	if b < 1024 {
+		return strconv.FormatUint(uint64(b), 10) + "B"
+	}
+	size, unit := float64(b), 0
+	for size >= 1024 && unit < len(byteSizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	formatted := strconv.FormatFloat(size, 'f', 1, 64)
+	return strings.TrimSuffix(formatted, ".0") + byteSizeUnits[unit]
+}
+
+func writeHumanString(buffer Buffer, s string) {
+	if strings.IndexFunc(s, humanSpecial) >= 0 {
+		buffer.AppendQuoted(s)
+		return
+	}
+	buffer.WriteString(s)
+}
+
+// humanSpecial reports whether r requires a human-readable value to be
+// quoted.
+func humanSpecial(r rune) bool {
+	switch {
+	case r == '"', r == '\'', r == '\\', r == 0:
+		return true
+	case unicode.IsLetter(r), unicode.IsNumber(r), unicode.IsPunct(r), unicode.IsSymbol(r):
+		return false
+	default:
+		return true
+	}
+}
+
+// FormatJsonContext renders the context fields as a JSON object.
+var FormatJsonContext = cacheFields(jsonFields{})
+
+// jsonFields renders context fields as the members of a JSON object.
+type jsonFields struct{}
+
+func (jsonFields) begin(buffer Buffer) {
+	buffer.WriteByte('{')
+}
+
+func (jsonFields) end(buffer Buffer) {
+	buffer.WriteByte('}')
+}
+
+func (jsonFields) separator(buffer Buffer) {
+	buffer.WriteByte(',')
+}
+
+func (jsonFields) member(buffer Buffer, key string, value interface{}) {
+	writeJSONString(buffer, key)
+	buffer.WriteByte(':')
+	writeJSONValue(buffer, value)
+}
+
+func (jsonFields) keys(fields Fields) []string {
+	return sortedFieldKeys(fields)
+}
+
+func (jsonFields) leading(key string) bool {
+	return false
 }
 
 func FormatStructuredContext(buffer Buffer, event *Event) {
@@ -327,7 +558,7 @@ func validStructuredKey(name string) bool {
 	if len(name) > 32 {
 		return false
 	}
-	for _, r := range []rune(name) {
+	for _, r := range name {
 		switch {
 		case r <= 32:
 			return false
@@ -351,12 +582,38 @@ func formatStructuredPair(buffer Buffer, name string, value interface{}) {
 // See Section 6.3.3 of RFC 5424 for details on the character escapes
 // XXX: Do we still need to send an escape if the value is already escaped?
 func formatStructuredValue(buffer Buffer, v interface{}) {
+	// Numbers and booleans never need escaping, so they're appended
+	// directly rather than converted to strings.
+	switch n := v.(type) {
+	case int:
+		buffer.AppendInt(int64(n))
+		return
+	case int64:
+		buffer.AppendInt(n)
+		return
+	case uint:
+		buffer.AppendUint(uint64(n))
+		return
+	case uint64:
+		buffer.AppendUint(n)
+		return
+	case float64:
+		buffer.AppendFloat(n, 'g', -1, 64)
+		return
+	case bool:
+		buffer.AppendBool(n)
+		return
+	case ByteSize:
+		buffer.AppendUint(uint64(n))
+		return
+	}
+
 	s, ok := v.(string)
 	if !ok {
 		s = fmt.Sprint(v)
 	}
 
-	for _, r := range []rune(s) {
+	for _, r := range s {
 		switch r {
 		case '\'':
 			buffer.WriteRune('\\')
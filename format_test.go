@@ -0,0 +1,174 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func benchmarkEvent() *Event {
+	return &Event{
+		Time:    time.Now(),
+		Level:   INFO,
+		Context: newLogger().WithName("bench").With(Fields{"user": "bob", "attempt": 3}).(*logger).context,
+		Frames:  getFrames(0, maxFrames),
+		Message: "user logged in",
+	}
+}
+
+func benchmarkFormatter(b *testing.B, formatter Formatter) {
+	event := benchmarkEvent()
+	buffer := NewBuffer()
+	defer ReleaseBuffer(buffer)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer.Reset()
+		formatter(buffer, event)
+	}
+}
+
+func BenchmarkHumanReadable(b *testing.B) {
+	benchmarkFormatter(b, HumanReadable)
+}
+
+func BenchmarkRFC5424(b *testing.B) {
+	benchmarkFormatter(b, rfc5424Formatter(LOCAL0, "bench", nil, "", nil, false))
+}
+
+// loggerContext returns the context of a child logger with ten fields, plus
+// two fields added per event as a message template would.
+func loggerContext(static bool) Context {
+	fields := make(Fields)
+	for i := 0; i < 10; i++ {
+		fields[fmt.Sprintf("field%d", i)] = i
+	}
+	ctx := EmptyContext.With(fields)
+	if static {
+		ctx = newLogger().With(fields).(*logger).context
+	}
+	return ctx.WithField("user", "bob").WithField("ip", "10.0.0.1")
+}
+
+func BenchmarkContextFields(b *testing.B) {
+	for _, static := range []bool{true, false} {
+		name := "Uncached"
+		if static {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			event := benchmarkEvent()
+			event.Context = loggerContext(static)
+			buffer := NewBuffer()
+			defer ReleaseBuffer(buffer)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buffer.Reset()
+				FormatJsonContext(buffer, event)
+			}
+		})
+	}
+}
+
+func TestCachedContextFields(t *testing.T) {
+	l := newLogger().With(Fields{"b": 2, "d": 4}).(*logger)
+	tests := []struct {
+		context Context
+		human   string
+		json    string
+	}{
+		{l.context, "b=2 d=4", `{"b":2,"d":4}`},
+		{l.context.WithField("c", 3).WithField("a", 1), "b=2 d=4 a=1 c=3", `{"b":2,"d":4,"a":1,"c":3}`},
+		{l.context.WithField("a", 1).WithField("a", 0), "b=2 d=4 a=0", `{"b":2,"d":4,"a":0}`},
+		{l.context.WithField("b", 0).WithField("a", 1), "a=1 b=0 d=4", `{"a":1,"b":0,"d":4}`},
+		{EmptyContext.WithField("b", 2), "b=2", `{"b":2}`},
+		{EmptyContext, "", `{}`},
+	}
+
+	for i, test := range tests {
+		// Render twice to exercise the cached path
+		for j := 0; j < 2; j++ {
+			event := &Event{Context: test.context}
+			if got := string(Render(FormatHumanContext, event)); got != test.human {
+				t.Errorf("%d: expected %q, got %q", i, test.human, got)
+			}
+			if got := string(Render(FormatJsonContext, event)); got != test.json {
+				t.Errorf("%d: expected %q, got %q", i, test.json, got)
+			}
+		}
+	}
+}
+
+func TestByteSizeRendering(t *testing.T) {
+	event := &Event{Context: EmptyContext.WithField("size", ByteSize(1536))}
+	for _, test := range []struct {
+		name      string
+		formatter Formatter
+		expected  string
+	}{
+		{"human", FormatHumanContext, "size=1.5KiB"},
+		{"logfmt", FormatLogfmtContext, "size=1536"},
+		{"json", FormatJsonContext, `{"size":1536}`},
+		{"structured", FormatStructuredContext, `size="1536"`},
+	} {
+		if got := string(Render(test.formatter, event)); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestFormatFormatterVerbs(t *testing.T) {
+	event := &Event{Context: EmptyContext}
+	for _, tt := range []struct {
+		format string
+		value  string
+		want   string
+	}{
+		{"[%v]", "abc", "[abc]"},
+		{"[%5v]", "abc", "[  abc]"},
+		{"[%-5v]", "abc", "[abc  ]"},
+		{"[%2v]", "abc", "[abc]"},
+		{"[%.2v]", "abc", "[ab]"},
+		{"[%.0v]", "abc", "[]"},
+		{"[%.10v]", "abc", "[abc]"},
+		{"[%5.2v]", "abc", "[   ab]"},
+		{"[%-5.2v]", "abc", "[ab   ]"},
+		{"[%.2v]", "héllo", "[hé]"},
+		{"[%4v]", "é", "[   é]"},
+		{"100%% %v", "abc", "100% abc"},
+		{"%%v %v", "abc", "%v abc"},
+		{"%d %v", "abc", "%d abc"},
+		{"%-v", "abc", "abc"},
+		{"%5", "abc", "%5"},
+		{"%v %v", "abc", "abc %!v(MISSING)"},
+		{"trailing %", "abc", "trailing %"},
+	} {
+		got := string(Render(FormatFormatter(tt.format, Literal(tt.value)), event))
+		if got != tt.want {
+			t.Errorf("FormatFormatter(%q) with %q rendered %q, want %q", tt.format, tt.value, got, tt.want)
+		}
+	}
+}
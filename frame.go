@@ -22,31 +22,109 @@ package main
 
 import (
 	"runtime"
+	"strings"
 )
 
 var nilFrame = (*Frame)(nil)
 
+// Frame describes a single frame of a captured call stack.  The accessors
+// are safe to call on a nil Frame and return placeholder values.
 type Frame struct {
 	pc uintptr
 	fn *runtime.Func
+
+	// Frames decoded from an encoded event have no runtime function, so they
+	// carry their details directly.
+	pkg, function, file string
+	line                int
+	decoded             bool
 }
 
+// frameForPC returns the frame for a return address captured by
+// runtime.Callers.  The address is backed up by one to land on the call
+// instruction itself so that the reported line is the call site.
 func frameForPC(pc uintptr) *Frame {
-	return nilFrame
+	frame := frameAt(pc)
+	if frame.unknown() {
+		return nilFrame
+	}
+	return &frame
+}
+
+// frameAt is like frameForPC, but returns the frame by value so that
+// formatters can read it without allocating.  The zero Frame is unknown.
+func frameAt(pc uintptr) Frame {
+	return Frame{pc: pc - 1, fn: runtime.FuncForPC(pc - 1)}
+}
+
+// decodedFrame returns a frame for details read back from an encoded event.
+func decodedFrame(pkg, function, file string, line int) *Frame {
+	return &Frame{pkg: pkg, function: function, file: file, line: line, decoded: true}
 }
 
+// unknown reports whether the frame has no details, either because it's
+// nil or because its function couldn't be found.
+func (f *Frame) unknown() bool {
+	return f == nil || f.fn == nil && !f.decoded
+}
+
+// Package returns the import path of the frame's package.
 func (f *Frame) Package() string {
-	return "???"
+	if f.unknown() {
+		return "???"
+	}
+	if f.fn == nil {
+		return f.pkg
+	}
+	pkg, _ := splitFuncName(f.fn.Name())
+	return pkg
 }
 
+// Function returns the name of the frame's function, including the
+// receiver type for methods.
 func (f *Frame) Function() string {
-	return "???"
+	if f.unknown() {
+		return "???"
+	}
+	if f.fn == nil {
+		return f.function
+	}
+	_, fn := splitFuncName(f.fn.Name())
+	return fn
 }
 
+// File returns the absolute path of the frame's source file.
 func (f *Frame) File() string {
-	return "???"
+	if f.unknown() {
+		return "???"
+	}
+	if f.fn == nil {
+		return f.file
+	}
+	file, _ := f.fn.FileLine(f.pc)
+	return file
 }
 
+// Line returns the frame's line number within its source file.
 func (f *Frame) Line() int {
-	return 0
+	if f.unknown() {
+		return 0
+	}
+	if f.fn == nil {
+		return f.line
+	}
+	_, line := f.fn.FileLine(f.pc)
+	return line
+}
+
+// splitFuncName splits a qualified function name such as
+// "github.com/user/pkg.(*T).Method" into its package and function parts.
+func splitFuncName(name string) (pkg string, fn string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot == -1 {
+		return "???", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
 }
@@ -0,0 +1,336 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// GELFCompression selects how GELF UDP payloads are compressed.
+type GELFCompression uint
+
+const (
+	GELFGzip GELFCompression = iota
+	GELFZlib
+	GELFUncompressed
+)
+
+const (
+	gelfVersion          = "1.1"
+	gelfDefaultChunkSize = 1420
+	gelfMaxChunks        = 128
+	gelfChunkHeaderSize  = 12
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+var errGELFTooLarge = errors.New("billet/target: GELF message needs more than 128 chunks")
+
+// FormatGELF renders events as GELF 1.1 JSON payloads using the local
+// fully-qualified hostname.
+var FormatGELF = GELFFormatter("")
+
+// GELFFormatter returns a formatter that renders events as GELF 1.1 JSON
+// payloads.  The first line of the message becomes the short_message, and
+// multi-line messages and stacks are sent as the full_message.  Levels map
+// to syslog severities, and the logger name, source location, error, and
+// context fields are sent as additional fields.  If host is empty, the
+// local fully-qualified hostname is used.
+func GELFFormatter(host string) Formatter {
+	hostFormatter := Literal(host)
+	if host == "" {
+		hostFormatter = FQDNFormatter()
+	}
+
+	return func(buffer Buffer, event *Event) {
+		obj := jsonObject{buffer: buffer}
+		obj.begin()
+		obj.key("version")
+		writeJSONString(buffer, gelfVersion)
+		obj.key("host")
+		buffer.WriteByte('"')
+		hostFormatter(buffer, event)
+		buffer.WriteByte('"')
+
+		short := strings.TrimSpace(event.Message)
+		multiline := false
+		if idx := strings.IndexByte(short, '\n'); idx != -1 {
+			short = strings.TrimSpace(short[:idx])
+			multiline = true
+		}
+		if short == "" {
+			// GELF requires a non-empty short_message
+			short = "-"
+		}
+		obj.key("short_message")
+		writeJSONString(buffer, short)
+		if multiline || event.HasFrames() {
+			obj.key("full_message")
+			writeGELFFullMessage(buffer, event)
+		}
+
+		obj.key("timestamp")
+		writeGELFTimestamp(buffer, event.Time)
+		obj.key("level")
+		buffer.AppendUint(uint64(severityFor(event.Level)))
+
+		if name := event.Context.Name(); name != "" {
+			obj.key("_logger")
+			writeJSONString(buffer, name)
+		}
+		if event.HasFrames() {
+			source := event.Source()
+			obj.key("_file")
+			writeJSONString(buffer, source.File())
+			obj.key("_line")
+			buffer.AppendInt(int64(source.Line()))
+		}
+		if event.Error != nil {
+			obj.key("_error")
+			writeJSONString(buffer, event.Error.Error())
+		}
+		if event.Context.NumFields() > 0 {
+			writeGELFFields(&obj, event)
+		}
+		obj.end()
+	}
+}
+
+// writeGELFFields writes the context fields as additional fields in sorted
+// order.  Fields whose names clash with the additional fields written for
+// the event itself, or with an earlier field once sanitized, are skipped.
+func writeGELFFields(obj *jsonObject, event *Event) {
+	fields := event.Context.Fields()
+	written := make(map[string]bool, len(fields))
+	written["_logger"] = event.Context.Name() != ""
+	written["_file"] = event.HasFrames()
+	written["_line"] = event.HasFrames()
+	written["_error"] = event.Error != nil
+	for _, k := range sortedFieldKeys(fields) {
+		name := gelfFieldName(k)
+		if written[name] {
+			continue
+		}
+		written[name] = true
+		obj.key(name)
+		writeJSONValue(obj.buffer, fields[k])
+	}
+}
+
+func writeGELFFullMessage(buffer Buffer, event *Event) {
+	full := NewBuffer()
+	defer ReleaseBuffer(full)
+	full.WriteString(event.Message)
+	if event.HasFrames() {
+		full.WriteByte('\n')
+		FormatStack(full, event)
+	}
+	writeJSONString(buffer, string(full.Bytes()))
+}
+
+// GELF timestamps are seconds since the epoch with an optional decimal part.
+// They're written from integers to avoid float64 rounding.
+func writeGELFTimestamp(buffer Buffer, t time.Time) {
+	micros := t.UnixNano() / int64(time.Microsecond)
+	buffer.AppendInt(micros / 1e6)
+	buffer.WriteByte('.')
+	frac := micros % 1e6
+	if frac < 0 {
+		frac = -frac
+	}
+	for div := int64(1e5); div > 0; div /= 10 {
+		buffer.WriteByte(byte('0' + frac/div%10))
+	}
+}
+
+// GELF additional field names must match ^[\w\.\-]*$, are prefixed with an
+// underscore, and may not be "_id".
+func gelfFieldName(key string) string {
+	name := []byte("_" + key)
+	for i := 1; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '.', c == '-':
+		default:
+			name[i] = '_'
+		}
+	}
+	if string(name) == "_id" {
+		return "__id"
+	}
+	return string(name)
+}
+
+// GELF sends events to Graylog using the GELF 1.1 protocol.  Over TCP,
+// messages are null-delimited and uncompressed.  Over UDP, messages are
+// compressed and split into GELF chunks when they exceed ChunkSize.  UDP
+// messages that would need more than 128 chunks can't be represented by the
+// protocol, so they're dropped and reported by the logger's next Flush.
+type GELF struct {
+	// Required
+	Address string
+
+	// Optional extras
+	Network     string          // Default: "udp"
+	Compression GELFCompression // Default: GELFGzip (UDP only)
+	ChunkSize   int             // Default: 1420, the maximum UDP datagram size
+	Formatter   Formatter       // Default: FormatGELF
+}
+
+func (g GELF) New() Collector {
+	if g.Address == "" {
+		panic("billet/target: GELF address cannot be empty")
+	}
+	if g.Network == "" {
+		g.Network = "udp"
+	}
+	if g.Compression > GELFUncompressed {
+		panic("billet/target: unknown GELF compression")
+	}
+	if g.ChunkSize <= gelfChunkHeaderSize {
+		g.ChunkSize = gelfDefaultChunkSize
+	}
+	if g.Formatter == nil {
+		g.Formatter = FormatGELF
+	}
+	return &gelfCollector{GELF: g}
+}
+
+type gelfCollector struct {
+	GELF
+	conn       net.Conn
+	compressed bytes.Buffer
+	chunk      []byte
+	dropped    int // Oversized messages not yet reported by Flush
+}
+
+func (g *gelfCollector) Collect(event *Event) error {
+	if g.conn == nil {
+		conn, err := net.Dial(g.Network, g.Address)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+
+	buf := NewBuffer()
+	defer ReleaseBuffer(buf)
+	g.Formatter(buf, event)
+
+	var err error
+	if strings.HasPrefix(g.Network, "udp") {
+		err = g.sendUDP(buf.Bytes())
+	} else {
+		buf.WriteByte(0)
+		_, err = buf.WriteTo(g.conn)
+	}
+	if err == errGELFTooLarge {
+		// Retrying can't shrink the message, so drop it rather than
+		// stalling the worker.
+		g.dropped++
+		return nil
+	}
+	if err != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+	return err
+}
+
+// Flush reports the messages dropped for being too large since the last
+// Flush.
+func (g *gelfCollector) Flush() error {
+	if g.dropped == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%w; dropped %d messages", errGELFTooLarge, g.dropped)
+	g.dropped = 0
+	return err
+}
+
+func (g *gelfCollector) sendUDP(payload []byte) error {
+	payload, err := g.compress(payload)
+	if err != nil {
+		return err
+	}
+	if len(payload) <= g.ChunkSize {
+		_, err = g.conn.Write(payload)
+		return err
+	}
+
+	dataSize := g.ChunkSize - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return errGELFTooLarge
+	}
+
+	if cap(g.chunk) < g.ChunkSize {
+		g.chunk = make([]byte, g.ChunkSize)
+	}
+	chunk := g.chunk[:gelfChunkHeaderSize]
+	copy(chunk, gelfChunkMagic)
+	binary.BigEndian.PutUint64(chunk[2:10], rand.Uint64())
+	chunk[11] = byte(count)
+	for seq := 0; seq < count; seq++ {
+		start := seq * dataSize
+		end := start + dataSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk[10] = byte(seq)
+		chunk = append(chunk[:gelfChunkHeaderSize], payload[start:end]...)
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gelfCollector) compress(payload []byte) ([]byte, error) {
+	var w io.WriteCloser
+	g.compressed.Reset()
+	switch g.Compression {
+	case GELFGzip:
+		w = gzip.NewWriter(&g.compressed)
+	case GELFZlib:
+		w = zlib.NewWriter(&g.compressed)
+	default:
+		return payload, nil
+	}
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return g.compressed.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFFieldClashes(t *testing.T) {
+	event := &Event{
+		Context: EmptyContext.WithName("n").
+			WithField("logger", "x").
+			WithField("error", "y").
+			WithField("b", 2).
+			WithField("a", 1),
+		Level: INFO,
+		Error: errors.New("e"),
+	}
+	rendered := string(Render(GELFFormatter("host"), event))
+	if strings.Count(rendered, `"_logger"`) != 1 || strings.Count(rendered, `"_error"`) != 1 {
+		t.Errorf("expected no duplicate keys, got %s", rendered)
+	}
+	if !strings.Contains(rendered, `"_a":1,"_b":2`) {
+		t.Errorf("expected sorted fields, got %s", rendered)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &decoded); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGELFTooManyChunks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	collector := GELF{
+		Address:     conn.LocalAddr().String(),
+		Compression: GELFUncompressed,
+		ChunkSize:   100,
+	}.New()
+	l := newLogger()
+	l.collect(INFO, collector)
+
+	// The oversized message is dropped without stalling the worker, so the
+	// next message is still delivered.
+	l.Info(strings.Repeat("x", 100*gelfMaxChunks))
+	l.Info("delivered")
+	if err := l.flush(5 * time.Second); !errors.Is(err, errGELFTooLarge) {
+		t.Errorf("expected the flush to report errGELFTooLarge, got %v", err)
+	}
+	if err := l.flush(5 * time.Second); err != nil {
+		t.Errorf("expected the drop to be reported once, got %v", err)
+	}
+
+	packet := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(packet[:n]), `"short_message":"delivered"`) {
+		t.Errorf("expected the next message to be delivered, got %s", packet[:n])
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+const jsonOmit = "-"
+
+const hexDigits = "0123456789abcdef"
+
+// FormatJSON renders events as single-line JSON objects using the default
+// JSON key names.
+var FormatJSON = JSON{}.Formatter()
+
+// JSON configures a formatter that renders each event as one self-contained
+// JSON object.  Empty key names use the defaults noted below, and a key name
+// of "-" omits the corresponding entry.
+type JSON struct {
+	TimeKey    string // Default: "time"
+	LevelKey   string // Default: "level"
+	NameKey    string // Default: "logger"
+	MessageKey string // Default: "msg"
+	FieldsKey  string // Default: "fields"
+	SourceKey  string // Default: "source"
+	ErrorKey   string // Default: "error"
+	StackKey   string // Default: "stack"
+
+	TimeFormat string // Default: time.RFC3339Nano
+	Stack      bool   // Include the event's full stack.  Default: false
+}
+
+// Formatter returns a Formatter that renders events as configured.
+func (j JSON) Formatter() Formatter {
+	j.TimeKey = defaultKey(j.TimeKey, "time")
+	j.LevelKey = defaultKey(j.LevelKey, "level")
+	j.NameKey = defaultKey(j.NameKey, "logger")
+	j.MessageKey = defaultKey(j.MessageKey, "msg")
+	j.FieldsKey = defaultKey(j.FieldsKey, "fields")
+	j.SourceKey = defaultKey(j.SourceKey, "source")
+	j.ErrorKey = defaultKey(j.ErrorKey, "error")
+	j.StackKey = defaultKey(j.StackKey, "stack")
+	if j.TimeFormat == "" {
+		j.TimeFormat = time.RFC3339Nano
+	}
+	if !j.Stack {
+		j.StackKey = jsonOmit
+	}
+
+	return func(buffer Buffer, event *Event) {
+		enc := jsonObject{buffer: buffer}
+		enc.begin()
+		if enc.key(j.TimeKey) {
+			buffer.WriteByte('"')
+			buffer.AppendTime(event.Time, j.TimeFormat)
+			buffer.WriteByte('"')
+		}
+		if enc.key(j.LevelKey) {
+			writeJSONString(buffer, event.Level.String())
+		}
+		if name := event.Context.Name(); name != "" && enc.key(j.NameKey) {
+			writeJSONString(buffer, name)
+		}
+		if enc.key(j.MessageKey) {
+			writeJSONString(buffer, event.Message)
+		}
+		if event.Context.NumFields() > 0 && enc.key(j.FieldsKey) {
+			FormatJsonContext(buffer, event)
+		}
+		if event.HasFrames() && enc.key(j.SourceKey) {
+			writeJSONFrame(buffer, event.Source())
+		}
+		if event.Error != nil && enc.key(j.ErrorKey) {
+			writeJSONString(buffer, event.Error.Error())
+		}
+		if event.HasFrames() && enc.key(j.StackKey) {
+			buffer.WriteByte('[')
+			for i, frame := range event.Stack() {
+				if i > 0 {
+					buffer.WriteByte(',')
+				}
+				writeJSONFrame(buffer, frame)
+			}
+			buffer.WriteByte(']')
+		}
+		enc.end()
+	}
+}
+
+func defaultKey(key string, def string) string {
+	if key == "" {
+		return def
+	}
+	return key
+}
+
+// jsonObject streams the members of a JSON object into a buffer, taking
+// care of the separators between them.
+type jsonObject struct {
+	buffer  Buffer
+	members int
+}
+
+func (o *jsonObject) begin() {
+	o.buffer.WriteByte('{')
+}
+
+func (o *jsonObject) end() {
+	o.buffer.WriteByte('}')
+}
+
+// key writes the next member's key and returns true, or returns false
+// without writing anything if the key is omitted.  The caller writes the
+// member's value when key returns true.
+func (o *jsonObject) key(name string) bool {
+	if name == jsonOmit {
+		return false
+	}
+	if o.members > 0 {
+		o.buffer.WriteByte(',')
+	}
+	o.members++
+	writeJSONString(o.buffer, name)
+	o.buffer.WriteByte(':')
+	return true
+}
+
+func writeJSONFields(buffer Buffer, fields Fields) {
+	obj := jsonObject{buffer: buffer}
+	obj.begin()
+	for _, k := range sortedFieldKeys(fields) {
+		obj.key(k)
+		writeJSONValue(buffer, fields[k])
+	}
+	obj.end()
+}
+
+func writeJSONFrame(buffer Buffer, frame *Frame) {
+	obj := jsonObject{buffer: buffer}
+	obj.begin()
+	obj.key("func")
+	writeJSONString(buffer, frame.Package()+"."+frame.Function())
+	obj.key("file")
+	writeJSONString(buffer, frame.File())
+	obj.key("line")
+	buffer.AppendInt(int64(frame.Line()))
+	obj.end()
+}
+
+// writeJSONValue encodes the basic types produced by Context.WithField
+// directly and falls back to encoding/json for anything else.
+func writeJSONValue(buffer Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case string:
+		writeJSONString(buffer, v)
+	case bool:
+		buffer.AppendBool(v)
+	case int:
+		buffer.AppendInt(int64(v))
+	case int8:
+		buffer.AppendInt(int64(v))
+	case int16:
+		buffer.AppendInt(int64(v))
+	case int32:
+		buffer.AppendInt(int64(v))
+	case int64:
+		buffer.AppendInt(v)
+	case uint:
+		buffer.AppendUint(uint64(v))
+	case uint8:
+		buffer.AppendUint(uint64(v))
+	case uint16:
+		buffer.AppendUint(uint64(v))
+	case uint32:
+		buffer.AppendUint(uint64(v))
+	case uint64:
+		buffer.AppendUint(v)
+	case float32:
+		writeJSONFloat(buffer, float64(v), 32)
+	case float64:
+		writeJSONFloat(buffer, v, 64)
+	case time.Time:
+		buffer.WriteByte('"')
+		buffer.AppendTime(v, time.RFC3339Nano)
+		buffer.WriteByte('"')
+	case error:
+		writeJSONString(buffer, v.Error())
+	case Fields:
+		writeJSONFields(buffer, v)
+	default:
+		marshaled, err := json.Marshal(v)
+		if err != nil {
+			writeJSONString(buffer, fmt.Sprint(v))
+			return
+		}
+		buffer.Write(marshaled)
+	}
+}
+
+// JSON has no representation for NaN or the infinities, so they're encoded
+// as strings.
+func writeJSONFloat(buffer Buffer, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		buffer.WriteByte('"')
+		buffer.AppendFloat(f, 'g', -1, bitSize)
+		buffer.WriteByte('"')
+		return
+	}
+	buffer.AppendFloat(f, 'g', -1, bitSize)
+}
+
+// writeJSONString writes s as a quoted JSON string.  Invalid UTF-8 is
+// replaced with U+FFFD, matching encoding/json.
+func writeJSONString(buffer Buffer, s string) {
+	buffer.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buffer.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				buffer.WriteByte('\\')
+				buffer.WriteByte(c)
+			case '\n':
+				buffer.WriteString(`\n`)
+			case '\r':
+				buffer.WriteString(`\r`)
+			case '\t':
+				buffer.WriteString(`\t`)
+			default:
+				buffer.WriteString(`\u00`)
+				buffer.WriteByte(hexDigits[c>>4])
+				buffer.WriteByte(hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buffer.WriteString(s[start:i])
+			buffer.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but break JavaScript parsers
+		if r == '\u2028' || r == '\u2029' {
+			buffer.WriteString(s[start:i])
+			buffer.WriteString(`\u202`)
+			buffer.WriteByte(hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buffer.WriteString(s[start:])
+	buffer.WriteByte('"')
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LayoutFactory builds a named layout element.  The argument is the text
+// after the element's colon, or an empty string if there isn't one.
+type LayoutFactory func(arg string) (Formatter, error)
+
+// LayoutFilter wraps the formatter for a layout element, such as to pad or
+// truncate its output.  The argument is the text after the filter's colon,
+// or an empty string if there isn't one.
+type LayoutFilter func(arg string, formatter Formatter) (Formatter, error)
+
+var layoutTimeFormats = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+var layoutFactories = map[string]LayoutFactory{
+	"time": func(arg string) (Formatter, error) {
+		return TimeFormatter(layoutTimeFormat(arg)), nil
+	},
+	"utctime": func(arg string) (Formatter, error) {
+		return UTCTimeFormatter(layoutTimeFormat(arg)), nil
+	},
+	"unix":         constFactory(FormatUnix),
+	"unixmilli":    constFactory(FormatUnixMilli),
+	"unixnano":     constFactory(FormatUnixNano),
+	"elapsed":      constFactory(FormatElapsed),
+	"delta":        func(string) (Formatter, error) { return DeltaFormatter(), nil },
+	"level":        constFactory(FormatLevel),
+	"name":         constFactory(formatName),
+	"source":       constFactory(HumanSource),
+	"package":      constFactory(FormatPackage),
+	"file":         constFactory(FormatFile),
+	"shortfile":    constFactory(FormatShortFile),
+	"line":         constFactory(FormatLine),
+	"msg":          constFactory(FormatMessage),
+	"rawmsg":       constFactory(FormatRawMessage),
+	"asciimsg":     constFactory(FormatAsciiMessage),
+	"fields":       constFactory(FormatHumanContext),
+	"jsonfields":   constFactory(FormatJsonContext),
+	"logfmtfields": constFactory(FormatLogfmtContext),
+	"stack":        constFactory(FormatStack),
+	"compactstack": constFactory(FormatCompactStack),
+	"host":         func(string) (Formatter, error) { return HostFormatter(), nil },
+	"fqdn":         func(string) (Formatter, error) { return FQDNFormatter(), nil },
+}
+
+var layoutFilters = map[string]LayoutFilter{
+	"pad":      intFilter(Pad, true),
+	"truncate": intFilter(Truncate, false),
+	"fixed":    intFilter(Fixed, true),
+	"upper": func(arg string, formatter Formatter) (Formatter, error) {
+		return Upper(formatter), nil
+	},
+	"lower": func(arg string, formatter Formatter) (Formatter, error) {
+		return Lower(formatter), nil
+	},
+	"iflevel": func(arg string, formatter Formatter) (Formatter, error) {
+		level, err := parseLevel(arg)
+		if err != nil {
+			return nil, err
+		}
+		return IfLevel(level, formatter), nil
+	},
+	"default": func(arg string, formatter Formatter) (Formatter, error) {
+		return Default(formatter, Literal(arg)), nil
+	},
+}
+
+// RegisterLayout makes a named element available to ParseLayout, replacing
+// any existing element with the same name.  Registration is not
+// synchronized, so it should happen during program initialization.
+func RegisterLayout(name string, factory LayoutFactory) {
+	layoutFactories[name] = factory
+}
+
+// RegisterLayoutFilter makes a named filter available to ParseLayout,
+// replacing any existing filter with the same name.  Like RegisterLayout, it
+// should be called during program initialization.
+func RegisterLayoutFilter(name string, filter LayoutFilter) {
+	layoutFilters[name] = filter
+}
+
+// ParseLayout compiles a layout string into a Formatter, so layouts can be
+// read from configuration files and flags.  Elements are written in braces
+// as {name}, {name:arg}, or with filters as {name:arg|filter:arg|...}.  Text
+// outside of braces is written literally; use {{ and }} for literal braces.
+// For example:
+//
+//	{time:RFC3339} {level|pad:-5} {source|iflevel:WARN} {msg} {fields}
+//
+// The built-in elements are time and utctime (with a named Go layout such
+// as RFC3339, or a literal layout), unix, unixmilli, unixnano, elapsed,
+// delta, level, name, source, package, file, shortfile, line, msg, rawmsg,
+// asciimsg, fields, jsonfields, logfmtfields, stack, compactstack, host,
+// and fqdn.  The built-in filters are pad, truncate, and
+// fixed (taking nonzero widths as with Pad, Truncate, and Fixed, and only
+// positive ones for truncate), upper, lower, iflevel (taking a level name),
+// and default (taking fallback text).
+func ParseLayout(layout string) (Formatter, error) {
+	var (
+		chain   []Formatter
+		literal []byte
+	)
+	for i := 0; i < len(layout); i++ {
+		c := layout[i]
+		switch {
+		case c == '{' && i+1 < len(layout) && layout[i+1] == '{',
+			c == '}' && i+1 < len(layout) && layout[i+1] == '}':
+			literal = append(literal, c)
+			i++
+		case c == '}':
+			return nil, layoutError(layout, i, "unmatched '}'")
+		case c == '{':
+			end := strings.IndexByte(layout[i+1:], '}')
+			if end == -1 {
+				return nil, layoutError(layout, i, "unterminated '{'")
+			}
+			if len(literal) > 0 {
+				chain = append(chain, Literal(string(literal)))
+				literal = nil
+			}
+			formatter, err := parseLayoutElement(layout, i+1, i+1+end)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, formatter)
+			i += end + 1
+		default:
+			literal = append(literal, c)
+		}
+	}
+	if len(literal) > 0 {
+		chain = append(chain, Literal(string(literal)))
+	}
+
+	return func(buffer Buffer, event *Event) {
+		for _, formatter := range chain {
+			formatter(buffer, event)
+		}
+	}, nil
+}
+
+// parseLayoutElement parses the element spanning layout[start:end], which
+// excludes the surrounding braces.
+func parseLayoutElement(layout string, start int, end int) (Formatter, error) {
+	parts := strings.Split(layout[start:end], "|")
+	name, arg := splitLayoutArg(parts[0])
+	if name == "" {
+		return nil, layoutError(layout, start, "missing element name")
+	}
+	factory, ok := layoutFactories[name]
+	if !ok {
+		return nil, layoutError(layout, start, fmt.Sprintf("unknown element %q", name))
+	}
+	formatter, err := factory(arg)
+	if err != nil {
+		return nil, layoutError(layout, start, fmt.Sprintf("element %q: %s", name, err))
+	}
+
+	offset := start + len(parts[0]) + 1
+	for _, part := range parts[1:] {
+		name, arg := splitLayoutArg(part)
+		filter, ok := layoutFilters[name]
+		if !ok {
+			return nil, layoutError(layout, offset, fmt.Sprintf("unknown filter %q", name))
+		}
+		formatter, err = filter(arg, formatter)
+		if err != nil {
+			return nil, layoutError(layout, offset, fmt.Sprintf("filter %q: %s", name, err))
+		}
+		offset += len(part) + 1
+	}
+	return formatter, nil
+}
+
+func splitLayoutArg(spec string) (name string, arg string) {
+	spec = strings.TrimSpace(spec)
+	idx := strings.IndexByte(spec, ':')
+	if idx == -1 {
+		return spec, ""
+	}
+	return strings.TrimSpace(spec[:idx]), spec[idx+1:]
+}
+
+func layoutError(layout string, offset int, msg string) error {
+	return fmt.Errorf("billet/format: invalid layout %q at offset %d: %s", layout, offset, msg)
+}
+
+// layoutTimeFormat resolves a named Go time layout, such as RFC3339, or
+// returns the argument as a literal layout.  The default is RFC3339.
+func layoutTimeFormat(arg string) string {
+	if arg == "" {
+		return time.RFC3339
+	}
+	if named, ok := layoutTimeFormats[arg]; ok {
+		return named
+	}
+	return arg
+}
+
+func constFactory(formatter Formatter) LayoutFactory {
+	return func(arg string) (Formatter, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+		return formatter, nil
+	}
+}
+
+// intFilter parses a width for the combinator.  Zero widths are rejected,
+// since they'd leave the output unchanged or empty, and so are negative ones
+// unless signed is set for a combinator that uses the sign for alignment.
+func intFilter(combinator func(int, Formatter) Formatter, signed bool) LayoutFilter {
+	return func(arg string, formatter Formatter) (Formatter, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return nil, fmt.Errorf("invalid width %q", arg)
+		}
+		if n == 0 || n < 0 && !signed {
+			return nil, fmt.Errorf("width %d is out of range", n)
+		}
+		return combinator(n, formatter), nil
+	}
+}
+
+func parseLevel(name string) (Level, error) {
+	for level := FATAL; level <= DEBUG; level++ {
+		if strings.EqualFold(strings.TrimSpace(name), level.String()) {
+			return level, nil
+		}
+	}
+	return OFF, fmt.Errorf("unknown level %q", name)
+}
+
+func formatName(buffer Buffer, event *Event) {
+	buffer.WriteString(event.Context.Name())
+}
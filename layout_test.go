@@ -0,0 +1,84 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLayout(t *testing.T) {
+	event := &Event{Time: time.Unix(0, 0), Level: WARN, Context: EmptyContext, Message: "hello"}
+	for _, tt := range []struct {
+		layout string
+		want   string
+	}{
+		{"{{{msg}}}", "{hello}"},
+		{"[{level|pad:-5}]", "[WARN ]"},
+		{"[{level|pad:5}]", "[ WARN]"},
+		{"{msg|truncate:3}", "hel"},
+		{"[{msg|fixed:-7}]", "[hello  ]"},
+		{"[{msg|fixed:3}]", "[hel]"},
+		{"{msg|upper|iflevel:ERROR}", ""},
+		{"{name|default:root}", "root"},
+	} {
+		formatter, err := ParseLayout(tt.layout)
+		if err != nil {
+			t.Errorf("ParseLayout(%q): %v", tt.layout, err)
+			continue
+		}
+		buffer := NewBuffer()
+		formatter(buffer, event)
+		if got := string(buffer.Bytes()); got != tt.want {
+			t.Errorf("ParseLayout(%q) rendered %q, want %q", tt.layout, got, tt.want)
+		}
+		ReleaseBuffer(buffer)
+	}
+}
+
+func TestParseLayoutErrors(t *testing.T) {
+	for _, tt := range []struct {
+		layout string
+		offset int
+		msg    string
+	}{
+		{"x}", 1, "unmatched '}'"},
+		{"ab{msg", 2, "unterminated '{'"},
+		{"{}", 1, "missing element name"},
+		{"x {nope}", 3, `unknown element "nope"`},
+		{"{msg:x}", 1, `element "msg": unexpected argument "x"`},
+		{"{msg|bogus}", 5, `unknown filter "bogus"`},
+		{"{msg|truncate:abc}", 5, `filter "truncate": invalid width "abc"`},
+		{"{msg|truncate:-1}", 5, `filter "truncate": width -1 is out of range`},
+		{"{msg|truncate:0}", 5, `filter "truncate": width 0 is out of range`},
+		{"{msg|pad:3|fixed:0}", 11, `filter "fixed": width 0 is out of range`},
+		{"{msg} {level|upper|pad:0}", 19, `filter "pad": width 0 is out of range`},
+		{"{level|iflevel:LOUD}", 7, `filter "iflevel": `},
+	} {
+		_, err := ParseLayout(tt.layout)
+		want := fmt.Sprintf("invalid layout %q at offset %d: %s", tt.layout, tt.offset, tt.msg)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseLayout(%q) returned %v, want %s", tt.layout, err, want)
+		}
+	}
+}
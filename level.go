@@ -57,3 +57,9 @@ func (l Level) String() string {
 		return "INVALID LEVEL"
 	}
 }
+
+// within reports whether l is at least as severe as threshold.  OFF is never
+// within any threshold.
+func (l Level) within(threshold Level) bool {
+	return l != OFF && l <= threshold
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatLogfmt renders events in logfmt: ts, level, and msg pairs, followed
+// by the logger name, error, and context fields when present.
+func FormatLogfmt(buffer Buffer, event *Event) {
+	buffer.WriteString("ts=")
+	buffer.AppendTime(event.Time, time.RFC3339Nano)
+	buffer.WriteString(" level=")
+	buffer.WriteString(event.Level.String())
+	buffer.WriteString(" msg=")
+	writeLogfmtValue(buffer, event.Message)
+	if name := event.Context.Name(); name != "" {
+		buffer.WriteString(" logger=")
+		writeLogfmtValue(buffer, name)
+	}
+	if event.Error != nil {
+		buffer.WriteString(" error=")
+		writeLogfmtValue(buffer, event.Error.Error())
+	}
+	if event.Context.NumFields() > 0 {
+		buffer.WriteByte(' ')
+		FormatLogfmtContext(buffer, event)
+	}
+}
+
+// FormatLogfmtContext renders only the event's context fields as logfmt
+// key=value pairs, sorted by key.
+func FormatLogfmtContext(buffer Buffer, event *Event) {
+	if event.Context.NumFields() == 0 {
+		return
+	}
+	fields := event.Context.Fields()
+
+	sortedKeys := sortedFieldKeys(fields)
+
+	for i, k := range sortedKeys {
+		writeLogfmtKey(buffer, k)
+		buffer.WriteByte('=')
+		writeLogfmtValue(buffer, fields[k])
+		if i < len(sortedKeys)-1 {
+			buffer.WriteByte(' ')
+		}
+	}
+}
+
+// logfmtSpecial extends the human-readable quoting rules with the '='
+// separator, which is otherwise allowed unquoted in human output.
+func logfmtSpecial(r rune) bool {
+	return r == '=' || humanSpecial(r)
+}
+
+// Keys can't be quoted in logfmt, so characters that would otherwise require
+// quoting are replaced with underscores.
+func writeLogfmtKey(buffer Buffer, key string) {
+	if key == "" {
+		buffer.WriteByte('_')
+		return
+	}
+	for _, r := range key {
+		if logfmtSpecial(r) {
+			buffer.WriteByte('_')
+		} else {
+			buffer.WriteRune(r)
+		}
+	}
+}
+
+func writeLogfmtValue(buffer Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		if v == "" || strings.IndexFunc(v, logfmtSpecial) >= 0 {
+			buffer.AppendQuoted(v)
+			return
+		}
+		buffer.WriteString(v)
+	case bool:
+		buffer.AppendBool(v)
+	case int:
+		buffer.AppendInt(int64(v))
+	case int64:
+		buffer.AppendInt(v)
+	case uint:
+		buffer.AppendUint(uint64(v))
+	case uint64:
+		buffer.AppendUint(v)
+	case float64:
+		buffer.AppendFloat(v, 'g', -1, 64)
+	case ByteSize:
+		buffer.AppendUint(uint64(v))
+	case time.Time:
+		buffer.AppendTime(v, time.RFC3339Nano)
+	case nil:
+		buffer.WriteString("null")
+	default:
+		writeLogfmtValue(buffer, fmt.Sprint(v))
+	}
+}
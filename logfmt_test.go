@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogfmtQuoting(t *testing.T) {
+	for _, tt := range []struct {
+		value interface{}
+		want  string
+	}{
+		{"plain", `plain`},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{"a=b", `"a=b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"it's", `"it's"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"tab\there", `"tab\there"`},
+		{"nul\x00", `"nul\x00"`},
+		{"héllo/€:1", `héllo/€:1`},
+		{"[]{},.;", `[]{},.;`},
+		{nil, `null`},
+		{true, `true`},
+		{-3, `-3`},
+		{int64(1) << 40, `1099511627776`},
+		{uint64(7), `7`},
+		{0.5, `0.5`},
+		{ByteSize(2048), `2048`},
+		{1500 * time.Millisecond, `1.5s`},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), `2024-01-02T03:04:05Z`},
+		{[]interface{}{"a", 1}, `"[a 1]"`},
+	} {
+		buffer := NewBufferFrom(nil)
+		writeLogfmtValue(buffer, tt.value)
+		if got := string(buffer.Bytes()); got != tt.want {
+			t.Errorf("value %#v rendered %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"key", "key"},
+		{"", "_"},
+		{"two words", "two_words"},
+		{"k=v", "k_v"},
+		{`"quoted"`, "_quoted_"},
+		{"clé.sub", "clé.sub"},
+	} {
+		buffer := NewBufferFrom(nil)
+		writeLogfmtKey(buffer, tt.key)
+		if got := string(buffer.Bytes()); got != tt.want {
+			t.Errorf("key %q rendered %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	event := &Event{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC),
+		Level:   WARN,
+		Context: EmptyContext.WithName("db pool").WithField("b", 2).WithField("a", "x y"),
+		Error:   errors.New("timed out"),
+		Message: "slow query",
+	}
+	want := `ts=2024-01-02T03:04:05.6Z level=WARN msg="slow query" logger="db pool" error="timed out" a="x y" b=2`
+	if got := string(Render(FormatLogfmt, event)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	event = &Event{Time: event.Time, Level: INFO, Context: EmptyContext, Message: "ok"}
+	want = `ts=2024-01-02T03:04:05.6Z level=INFO msg=ok`
+	if got := string(Render(FormatLogfmt, event)); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -21,46 +21,220 @@
 package main
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 )
 
+const (
+	defaultFlushTimeout   = 5 * time.Second
+	goroutinePanicMessage = "Recovered panic in goroutine"
+)
+
 var nilError = (error)(nil)
 var RootLogger = newLogger()
 
+var errFlushTimeout = errors.New("timeout waiting for collectors to flush")
+
+// exit terminates the process after a fatal event has been flushed.  It's
+// replaceable via SetExitHook.
+var exit = os.Exit
+
+// RecoveryMode determines what Logger.Recover does with a recovered panic
+// once the panic event has been flushed to collectors.
+type RecoveryMode uint
+
+const (
+	// Swallow returns the recovered value to the caller of Recover.
+	Swallow RecoveryMode = iota
+
+	// Repanic panics again with the recovered value.
+	Repanic
+
+	// Exit terminates the process with exit status 1.
+	Exit
+)
+
 type Collector interface {
 	Collect(e *Event) error
 }
 
+// Flusher is implemented by collectors that buffer events internally, such
+// as batching collectors.  Flush is called whenever the logger flushes its
+// collectors, including before Fatal exits and before Panic panics.  Its
+// errors are returned by the package-level Flush and Close.
+type Flusher interface {
+	Flush() error
+}
+
 type Logger interface {
-	Panic()
+	// Debug, Info, Warn, and Error log an event at their level with a message
+	// rendered from a template.  Holes in the template, such as {user}, are
+	// replaced with the args in order and the values are also added to the
+	// event's context under the hole names.  See TemplateKey for details.
+	// Unlike fmt.Printf, verbs such as %d are written literally, and args
+	// without a matching hole are dropped.
+	Debug(template string, args ...interface{})
+	Info(template string, args ...interface{})
+	Warn(template string, args ...interface{})
+	Error(template string, args ...interface{})
+
+	// Fatal logs a FATAL event with a message rendered from the template, as
+	// for Error, and blocks until every collector has delivered it or the
+	// flush timeout passes.  It then calls the exit hook, which defaults to
+	// os.Exit(1).
+	Fatal(template string, args ...interface{})
+
+	// Panic logs a FATAL event with a message rendered from the template,
+	// waits for the event to be flushed, and then panics with the rendered
+	// message as an error.
+	Panic(template string, args ...interface{})
+
+	// Recover must be deferred.  If the surrounding function panics, Recover
+	// logs a FATAL event with the given message, the panic value as the
+	// event's Error, and the stack where the panic was raised.  Once the
+	// event is flushed, the configured RecoveryMode is applied.
 	Recover(message string) interface{}
+
+	// Go runs fn in a new goroutine with a deferred Recover, so a panic in fn
+	// is logged with its full stack and flushed before the RecoveryMode is
+	// applied.
+	Go(fn func())
+
+	// GoContext is like Go, but passes ctx through to fn.
+	GoContext(ctx gocontext.Context, fn func(ctx gocontext.Context))
+
+	// WithField, With, and WithName return a child logger whose events carry
+	// the logger's context with the given fields or name.  The child shares
+	// the logger's collectors and settings.  Formatters cache their
+	// rendering of a logger's context, so fields shared by many events are
+	// cheapest when added here rather than per event.
+	WithField(key string, value interface{}) Logger
+	With(fields Fields) Logger
+	WithName(name string) Logger
 }
 
 func CollectAsync(threshold Level, bufsize int, discard bool, c Collector) {
-	RootLogger.collect(c)
+	RootLogger.collect(threshold, c)
+}
+
+// Flush waits up to timeout for every collector to finish collecting the
+// events logged so far.  Errors returned by the collectors' Flush methods,
+// such as batches a server rejected, are joined and returned.
+func Flush(timeout time.Duration) error {
+	return RootLogger.flush(timeout)
 }
 
+// Close flushes every collector as Flush does, then closes the collectors
+// that implement io.Closer and stops their workers.  Events logged after
+// Close are discarded.
 func Close(timeout time.Duration) error {
 	return RootLogger.close(timeout)
 }
 
+// SetRecoveryMode sets the RecoveryMode applied by Logger.Recover.  The
+// default is Swallow.
+func SetRecoveryMode(mode RecoveryMode) {
+	RootLogger.recoveryMode = mode
+}
+
+// SetFlushTimeout sets how long Fatal, Panic, and Recover wait for
+// collectors to deliver their events before proceeding.  The default is 5
+// seconds.
+func SetFlushTimeout(timeout time.Duration) {
+	RootLogger.flushTimeout = timeout
+}
+
+// SetExitHook replaces the function called with exit status 1 after a fatal
+// event has been flushed.  This is primarily useful for intercepting exits
+// in tests.  Passing nil restores the default, os.Exit.
+func SetExitHook(hook func(code int)) {
+	if hook == nil {
+		hook = os.Exit
+	}
+	exit = hook
+}
+
 type logger struct {
 	context    Context
-	registry   registry
 	skipFrames int
+	*loggerConfig
+}
+
+// loggerConfig holds the collectors and settings shared by a logger and its
+// children.
+type loggerConfig struct {
+	registry     registry
+	recoveryMode RecoveryMode
+	flushTimeout time.Duration
+	crashDir     string
+}
+
+// loggedPanic wraps the panic value raised by Logger.Panic.  The event for
+// the panic has already been sent, so Recover mustn't send another.
+type loggedPanic struct {
+	error
 }
 
 func newLogger() *logger {
 	return &logger{
-		context:  EmptyContext,
-		registry: make(registry),
+		context: EmptyContext,
+		loggerConfig: &loggerConfig{
+			registry:     make(registry),
+			flushTimeout: defaultFlushTimeout,
+		},
+	}
+}
+
+func (l *logger) WithField(key string, value interface{}) Logger {
+	return l.child(l.context.WithField(key, value))
+}
+
+func (l *logger) With(fields Fields) Logger {
+	return l.child(l.context.With(fields))
+}
+
+func (l *logger) WithName(name string) Logger {
+	return l.child(l.context.WithName(name))
+}
+
+// child returns a logger for context that shares l's configuration.  The
+// context's fields are marked static so that formatters cache them.
+func (l *logger) child(ctx Context) Logger {
+	if c, ok := ctx.(*context); ok && c.fieldList != nil {
+		c.fieldList.markStatic()
+	}
+	return &logger{
+		context:      ctx,
+		skipFrames:   l.skipFrames,
+		loggerConfig: l.loggerConfig,
 	}
 }
 
-func (l *logger) Panic() {
-	l.sendPanic()
+func (l *logger) Debug(template string, args ...interface{}) {
+	l.sendTemplate(DEBUG, template, args)
+}
+
+func (l *logger) Info(template string, args ...interface{}) {
+	l.sendTemplate(INFO, template, args)
+}
+
+func (l *logger) Warn(template string, args ...interface{}) {
+	l.sendTemplate(WARN, template, args)
+}
+
+func (l *logger) Error(template string, args ...interface{}) {
+	l.sendTemplate(ERROR, template, args)
+}
+
+func (l *logger) Fatal(template string, args ...interface{}) {
+	l.sendFatal(template, args)
+}
+
+func (l *logger) Panic(template string, args ...interface{}) {
+	l.sendPanic(template, args)
 }
 
 func (l *logger) Recover(message string) interface{} {
@@ -68,50 +242,152 @@ func (l *logger) Recover(message string) interface{} {
 	if cause == nil {
 		return nil
 	}
-	l.sendRecovery()
+	if logged, ok := cause.(loggedPanic); ok {
+		return l.applyRecoveryMode(logged, logged.error)
+	}
+	l.sendRecovery(message, cause)
+	return l.applyRecoveryMode(cause, cause)
+}
+
+func (l *logger) Go(fn func()) {
+	go func() {
+		defer l.Recover(goroutinePanicMessage)
+		fn()
+	}()
+}
+
+func (l *logger) GoContext(ctx gocontext.Context, fn func(ctx gocontext.Context)) {
+	go func() {
+		defer l.Recover(goroutinePanicMessage)
+		fn(ctx)
+	}()
+}
+
+// applyRecoveryMode re-panics with panicValue or exits as configured.
+// Otherwise the recovered cause is returned to the caller.
+func (l *logger) applyRecoveryMode(panicValue interface{}, cause interface{}) interface{} {
+	switch l.recoveryMode {
+	case Repanic:
+		doPanic(panicValue)
+	case Exit:
+		exit(1)
+	}
 	return cause
 }
 
-func (l *logger) sendPanic() {
-	event := l.newEvent("")
-	event.Error = errors.New("blah")
+func (l *logger) sendTemplate(level Level, template string, args []interface{}) {
+	event := l.newEvent(level, "")
+	event.Message, event.Context = renderTemplate(event.Context, template, args)
+	event.Frames = fillFrames(event.Frames, 2+l.skipFrames, maxFrames)
+	l.dispatchEvent(event)
+}
+
+func (l *logger) sendFatal(template string, args []interface{}) {
+	event := l.newEvent(FATAL, "")
+	event.Message, event.Context = renderTemplate(event.Context, template, args)
+	event.Frames = fillFrames(event.Frames, 2+l.skipFrames, maxFrames)
 	l.dispatchEvent(event)
-	doPanic("blah")
+	l.flush(l.flushTimeout)
+	exit(1)
 }
 
-func (l *logger) sendRecovery() {
-	event := l.newEvent("")
-	event.Error = errors.New("blah")
+func (l *logger) sendPanic(template string, args []interface{}) {
+	event := l.newEvent(FATAL, "")
+	event.Message, event.Context = renderTemplate(event.Context, template, args)
+	cause := errors.New(event.Message)
+	event.Error = cause
+	event.Frames = fillFrames(event.Frames, 2+l.skipFrames, maxFrames)
 	l.dispatchEvent(event)
+	l.flush(l.flushTimeout)
+	doPanic(loggedPanic{cause})
 }
 
-func (l *logger) newEvent(message string) *Event {
-	event := &Event{
-		Time:    time.Now(),
-		Level:   FATAL,
-		Context: l.context,
-		Message: message,
+func (l *logger) sendRecovery(message string, cause interface{}) {
+	event := l.newEvent(FATAL, message)
+	event.Error = panicError(cause)
+	event.Frames = getRecoveryFrames(2+l.skipFrames, maxFrames)
+	l.dispatchEvent(event)
+	l.flush(l.flushTimeout)
+}
+
+// panicError returns the recovered panic value as an error, converting it
+// if it isn't one already.
+func panicError(cause interface{}) error {
+	if err, ok := cause.(error); ok {
+		return err
 	}
+	return fmt.Errorf("%v", cause)
+}
+
+func (l *logger) newEvent(level Level, message string) *Event {
+	event := getEvent()
+	event.Time = time.Now()
+	event.Level = level
+	event.Context = l.context
+	event.Message = message
 	return event
 }
 
 func (l *logger) dispatchEvent(event *Event) {
+	event.Context = withErrorFields(event.Context, event.Error)
+	if event.Level == FATAL && l.crashDir != "" {
+		event.Context = withCrashDump(l.crashDir, event)
+	}
+
+	// Hold our own reference while sending so a fast worker can't return
+	// the event to the pool before it has reached every other worker.
+	event.retain(1)
 	for _, entry := range l.registry {
-		entry.worker.send(event)
+		if event.Level.within(entry.threshold) {
+			event.retain(1)
+			entry.worker.send(event)
+		}
 	}
+	event.release()
 }
 
-func (l *logger) collect(c Collector) {
+func (l *logger) collect(threshold Level, c Collector) {
 	l.registry[c] = &entry{
-		worker: newWorker(c),
+		threshold: threshold,
+		worker:    newWorker(c),
 	}
 }
 
+// flush waits for every registered collector to finish collecting the events
+// dispatched so far, or for the timeout to elapse.
+func (l *logger) flush(timeout time.Duration) error {
+	var pending []<-chan error
+	for _, entry := range l.registry {
+		pending = append(pending, entry.worker.flush())
+	}
+	return awaitWorkers(pending, timeout)
+}
+
+// close flushes and closes every registered collector and removes them from
+// the registry.
 func (l *logger) close(timeout time.Duration) error {
-	fmt.Println("before select")
-	select {
-	case <-time.After(time.Second):
-		fmt.Println("timeout occurred")
-		return errors.New("timeout")
+	var pending []<-chan error
+	for c, entry := range l.registry {
+		pending = append(pending, entry.worker.close())
+		delete(l.registry, c)
+	}
+	return awaitWorkers(pending, timeout)
+}
+
+// awaitWorkers waits for each worker's flush result and joins the errors.
+func awaitWorkers(pending []<-chan error, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var errs []error
+	for _, flushed := range pending {
+		select {
+		case err := <-flushed:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-timer.C:
+			return errFlushTimeout
+		}
 	}
+	return errors.Join(errs...)
 }
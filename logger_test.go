@@ -0,0 +1,345 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	gocontext "context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a collector that records the messages of the events it
+// collects, along with copies of the events.
+type recorder struct {
+	mu       sync.Mutex
+	messages []string
+	events   []*Event
+}
+
+func (r *recorder) Collect(event *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, event.Level.String()+" "+event.Message)
+	r.events = append(r.events, event.Clone())
+	return nil
+}
+
+func (r *recorder) recordedEvents() []*Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Event(nil), r.events...)
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.messages...)
+}
+
+func TestThresholds(t *testing.T) {
+	l := newLogger()
+	errs, debug := &recorder{}, &recorder{}
+	l.collect(ERROR, errs)
+	l.collect(DEBUG, debug)
+
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	if err := l.flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := errs.recorded(); len(got) != 1 || got[0] != "ERROR error" {
+		t.Errorf("ERROR collector got %q", got)
+	}
+	if got := debug.recorded(); len(got) != 4 {
+		t.Errorf("DEBUG collector got %q", got)
+	}
+}
+
+func TestFatalTemplate(t *testing.T) {
+	exited := false
+	SetExitHook(func(code int) { exited = true })
+	defer SetExitHook(nil)
+
+	l := newLogger()
+	r := &recorder{}
+	l.collect(FATAL, r)
+	l.Fatal("user {user} failed", "bob")
+
+	if !exited {
+		t.Error("expected the exit hook to be called")
+	}
+	if got := r.recorded(); len(got) != 1 || got[0] != "FATAL user bob failed" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// panicWith panics with v, so tests can check that recovery stacks start at
+// the panic.
+func panicWith(v interface{}) {
+	panic(v)
+}
+
+// recoverFrom calls fn with a deferred Recover and returns what reached the
+// caller: the value of a re-panic, if any.
+func recoverFrom(l *logger, fn func()) (repanicked interface{}) {
+	defer func() {
+		repanicked = recover()
+	}()
+	func() {
+		defer l.Recover("recovered")
+		fn()
+	}()
+	return nil
+}
+
+func TestRecoverModes(t *testing.T) {
+	cause := errors.New("boom")
+	for _, tt := range []struct {
+		name       string
+		mode       RecoveryMode
+		repanicked interface{}
+		exited     bool
+	}{
+		{"Swallow", Swallow, nil, false},
+		{"Repanic", Repanic, cause, false},
+		{"Exit", Exit, nil, true},
+	} {
+		exited := false
+		SetExitHook(func(code int) { exited = code == 1 })
+
+		l := newLogger()
+		l.recoveryMode = tt.mode
+		r := &recorder{}
+		l.collect(FATAL, r)
+		repanicked := recoverFrom(l, func() { panicWith(cause) })
+		SetExitHook(nil)
+
+		if repanicked != tt.repanicked {
+			t.Errorf("%s: re-panicked with %v, want %v", tt.name, repanicked, tt.repanicked)
+		}
+		if exited != tt.exited {
+			t.Errorf("%s: exited %v, want %v", tt.name, exited, tt.exited)
+		}
+		// The event is flushed before the mode is applied.
+		if got := r.recorded(); len(got) != 1 || got[0] != "FATAL recovered" {
+			t.Errorf("%s: recorded %q", tt.name, got)
+		}
+	}
+}
+
+func TestRecoverEvent(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+		err   string
+	}{
+		{"error", errors.New("boom"), "boom"},
+		{"string", "boom", "boom"},
+		{"int", 42, "42"},
+	} {
+		l := newLogger()
+		r := &recorder{}
+		l.collect(FATAL, r)
+		recoverFrom(l, func() { panicWith(tt.value) })
+
+		events := r.recordedEvents()
+		if len(events) != 1 {
+			t.Fatalf("%s: recorded %d events", tt.name, len(events))
+		}
+		event := events[0]
+		if event.Error == nil || event.Error.Error() != tt.err {
+			t.Errorf("%s: recorded error %v, want %s", tt.name, event.Error, tt.err)
+		}
+		if err, ok := tt.value.(error); ok && event.Error != err {
+			t.Errorf("%s: expected the panic value itself as the error", tt.name)
+		}
+		if fn := event.Source().Function(); fn != "panicWith" {
+			t.Errorf("%s: stack starts at %s, want panicWith", tt.name, fn)
+		}
+	}
+}
+
+func TestRecoverRuntimeError(t *testing.T) {
+	l := newLogger()
+	r := &recorder{}
+	l.collect(FATAL, r)
+	recoverFrom(l, func() {
+		var m map[string]int
+		m["x"] = 1
+	})
+
+	events := r.recordedEvents()
+	if len(events) != 1 {
+		t.Fatalf("recorded %d events", len(events))
+	}
+	if source := events[0].Source(); source.Package() == "runtime" {
+		t.Errorf("expected the stack to start in user code, got %s.%s", source.Package(), source.Function())
+	}
+}
+
+func TestPanicRecoveredOnce(t *testing.T) {
+	l := newLogger()
+	l.recoveryMode = Repanic
+	r := &recorder{}
+	l.collect(FATAL, r)
+	repanicked := recoverFrom(l, func() { l.Panic("bad {n}", 7) })
+
+	if err, ok := repanicked.(error); !ok || err.Error() != "bad 7" {
+		t.Errorf("re-panicked with %v", repanicked)
+	}
+	if got := r.recorded(); len(got) != 1 || got[0] != "FATAL bad 7" {
+		t.Errorf("expected Recover not to log the logged panic again, got %q", got)
+	}
+}
+
+func TestGo(t *testing.T) {
+	type key struct{}
+	ctx := gocontext.WithValue(gocontext.Background(), key{}, "from context")
+
+	for _, tt := range []struct {
+		name  string
+		start func(l *logger)
+		want  string
+	}{
+		{"Go", func(l *logger) { l.Go(func() { panicWith("from Go") }) }, "from Go"},
+		{"GoContext", func(l *logger) {
+			l.GoContext(ctx, func(ctx gocontext.Context) { panicWith(ctx.Value(key{})) })
+		}, "from context"},
+	} {
+		// Exit mode signals once the panic event has been flushed.
+		exited := make(chan int, 1)
+		SetExitHook(func(code int) { exited <- code })
+
+		l := newLogger()
+		l.recoveryMode = Exit
+		r := &recorder{}
+		l.collect(FATAL, r)
+		tt.start(l)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the goroutine's panic wasn't recovered", tt.name)
+		}
+		SetExitHook(nil)
+
+		events := r.recordedEvents()
+		if len(events) != 1 || events[0].Message != goroutinePanicMessage {
+			t.Fatalf("%s: recorded %q", tt.name, r.recorded())
+		}
+		if err := events[0].Error; err == nil || err.Error() != tt.want {
+			t.Errorf("%s: recorded error %v, want %s", tt.name, err, tt.want)
+		}
+		if fn := events[0].Source().Function(); fn != "panicWith" {
+			t.Errorf("%s: stack starts at %s, want panicWith", tt.name, fn)
+		}
+	}
+}
+
+// gatedCollector holds each event until its gate is closed.
+type gatedCollector struct {
+	recorder
+	gate chan struct{}
+}
+
+func (c *gatedCollector) Collect(event *Event) error {
+	<-c.gate
+	return c.recorder.Collect(event)
+}
+
+func TestFatalFlushesBeforeExit(t *testing.T) {
+	l := newLogger()
+	c := &gatedCollector{gate: make(chan struct{})}
+	l.collect(FATAL, c)
+
+	var delivered []string
+	SetExitHook(func(code int) { delivered = c.recorded() })
+	defer SetExitHook(nil)
+	time.AfterFunc(50*time.Millisecond, func() { close(c.gate) })
+	l.Fatal("fatal")
+
+	if len(delivered) != 1 || delivered[0] != "FATAL fatal" {
+		t.Errorf("expected the event to be delivered before exiting, got %q", delivered)
+	}
+}
+
+func TestFatalFlushTimeout(t *testing.T) {
+	previous := RootLogger.flushTimeout
+	SetFlushTimeout(50 * time.Millisecond)
+	defer SetFlushTimeout(previous)
+
+	l := RootLogger
+	c := &gatedCollector{gate: make(chan struct{})}
+	l.collect(FATAL, c)
+	defer func() {
+		close(c.gate)
+		delete(l.registry, c)
+	}()
+
+	exited := false
+	SetExitHook(func(code int) { exited = code == 1 })
+	defer SetExitHook(nil)
+	start := time.Now()
+	l.Fatal("stuck")
+
+	if !exited {
+		t.Error("expected the exit hook to be called")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected Fatal to give up after the flush timeout, took %s", elapsed)
+	}
+	if got := c.recorded(); len(got) != 0 {
+		t.Errorf("expected the stuck collector not to have delivered, got %q", got)
+	}
+}
+
+// formatCollector renders each event into a reused buffer and discards it.
+type formatCollector struct {
+	formatter Formatter
+	buffer    Buffer
+}
+
+func (c *formatCollector) Collect(event *Event) error {
+	c.buffer.Reset()
+	c.formatter(c.buffer, event)
+	return nil
+}
+
+// BenchmarkLogger measures the full path from a logging call through the
+// worker to a collector, including event pooling and stack capture.
+func BenchmarkLogger(b *testing.B) {
+	l := newLogger()
+	l.collect(INFO, &formatCollector{formatter: HumanReadable, buffer: NewBuffer()})
+	child := l.WithName("bench").WithField("user", "bob")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		child.Info("user logged in")
+	}
+	if err := l.flush(time.Minute); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -42,5 +42,5 @@ func main() {
 
 func reproduce() {
 	defer log.Recover("Test")
-	log.Panic()
+	log.Panic("Test")
 }
@@ -0,0 +1,354 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// msgpackTimestamp is the MessagePack extension type for timestamps.
+const msgpackTimestamp = -1
+
+// FormatMsgpack renders events as MessagePack maps with the time, level,
+// name, message, error, context fields, and frames.  Context values keep
+// their native types, and times use the MessagePack timestamp extension.
+// Use DecodeMsgpack to read the events back.
+func FormatMsgpack(buffer Buffer, event *Event) {
+	writeBinaryEvent(msgpackEncoder{}, buffer, event)
+}
+
+// DecodeMsgpack decodes the first event rendered by FormatMsgpack from data
+// and returns it with the remaining bytes.  Non-negative integer fields are
+// decoded as int64 when they fit and uint64 otherwise, and negative ones as
+// int64, so durations and byte sizes are read back as plain integers.  The
+// decoded error only retains its message.
+func DecodeMsgpack(data []byte) (event *Event, rest []byte, err error) {
+	r := &msgpackReader{binaryReader{data: data}}
+	decoded, err := r.value(0)
+	if err != nil {
+		return nil, data, err
+	}
+	event, err = binaryEvent(decoded)
+	if err != nil {
+		return nil, data, err
+	}
+	return event, r.data, nil
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) writeMap(buffer Buffer, n int) {
+	msgpackHeader(buffer, n, 0x80, 16, 0xde, 0xdf)
+}
+
+func (msgpackEncoder) writeArray(buffer Buffer, n int) {
+	msgpackHeader(buffer, n, 0x90, 16, 0xdc, 0xdd)
+}
+
+func (msgpackEncoder) writeString(buffer Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buffer.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buffer.WriteByte(0xd9)
+		buffer.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(0xda)
+		writeBigEndian(buffer, uint64(n), 2)
+	default:
+		buffer.WriteByte(0xdb)
+		writeBigEndian(buffer, uint64(n), 4)
+	}
+	buffer.WriteString(s)
+}
+
+func (e msgpackEncoder) writeInt(buffer Buffer, i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(buffer, uint64(i))
+	case i >= -32:
+		buffer.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		writeBigEndian(buffer, uint64(i), 2)
+	case i >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		writeBigEndian(buffer, uint64(i), 4)
+	default:
+		buffer.WriteByte(0xd3)
+		writeBigEndian(buffer, uint64(i), 8)
+	}
+}
+
+func (msgpackEncoder) writeUint(buffer Buffer, u uint64) {
+	switch {
+	case u < 128:
+		buffer.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buffer.WriteByte(0xcc)
+		buffer.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		writeBigEndian(buffer, u, 2)
+	case u <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		writeBigEndian(buffer, u, 4)
+	default:
+		buffer.WriteByte(0xcf)
+		writeBigEndian(buffer, u, 8)
+	}
+}
+
+func (msgpackEncoder) writeFloat32(buffer Buffer, f float32) {
+	buffer.WriteByte(0xca)
+	writeBigEndian(buffer, uint64(math.Float32bits(f)), 4)
+}
+
+func (msgpackEncoder) writeFloat64(buffer Buffer, f float64) {
+	buffer.WriteByte(0xcb)
+	writeBigEndian(buffer, math.Float64bits(f), 8)
+}
+
+func (msgpackEncoder) writeBool(buffer Buffer, b bool) {
+	if b {
+		buffer.WriteByte(0xc3)
+	} else {
+		buffer.WriteByte(0xc2)
+	}
+}
+
+func (msgpackEncoder) writeNil(buffer Buffer) {
+	buffer.WriteByte(0xc0)
+}
+
+// writeTime uses the smallest of the 32, 64, and 96-bit timestamp formats
+// that can represent t.
+func (msgpackEncoder) writeTime(buffer Buffer, t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		buffer.WriteByte(0xd6)
+		buffer.WriteByte(0xff)
+		writeBigEndian(buffer, uint64(sec), 4)
+	case sec >= 0 && sec < 1<<34:
+		buffer.WriteByte(0xd7)
+		buffer.WriteByte(0xff)
+		writeBigEndian(buffer, nsec<<34|uint64(sec), 8)
+	default:
+		buffer.WriteByte(0xc7)
+		buffer.WriteByte(12)
+		buffer.WriteByte(0xff)
+		writeBigEndian(buffer, nsec, 4)
+		writeBigEndian(buffer, uint64(sec), 8)
+	}
+}
+
+// msgpackHeader writes a map or array header using the fix, 16-bit, or
+// 32-bit form.
+func msgpackHeader(buffer Buffer, n int, fix byte, fixLimit int, code16, code32 byte) {
+	switch {
+	case n < fixLimit:
+		buffer.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(code16)
+		writeBigEndian(buffer, uint64(n), 2)
+	default:
+		buffer.WriteByte(code32)
+		writeBigEndian(buffer, uint64(n), 4)
+	}
+}
+
+// writeBigEndian writes the low size bytes of u, most significant first.
+func writeBigEndian(buffer Buffer, u uint64, size int) {
+	for shift := uint(size-1) * 8; ; shift -= 8 {
+		buffer.WriteByte(byte(u >> shift))
+		if shift == 0 {
+			return
+		}
+	}
+}
+
+type msgpackReader struct {
+	binaryReader
+}
+
+func (r *msgpackReader) value(depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errBinaryDepth
+	}
+	code, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80:
+		return r.fields(uint64(code&0x0f), depth)
+	case code&0xf0 == 0x90:
+		return r.list(uint64(code&0x0f), depth)
+	case code&0xe0 == 0xa0:
+		return r.str(uint64(code & 0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return r.sized(1, r.str)
+	case 0xc5, 0xda:
+		return r.sized(2, r.str)
+	case 0xc6, 0xdb:
+		return r.sized(4, r.str)
+	case 0xc7:
+		return r.ext(1)
+	case 0xc8:
+		return r.ext(2)
+	case 0xc9:
+		return r.ext(4)
+	case 0xca:
+		u, err := r.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := r.uint(1 << (code - 0xcc))
+		return binaryInt(u), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := uint64(1) << (code - 0xd0)
+		u, err := r.uint(size)
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.extData(uint64(1) << (code - 0xd4))
+	case 0xdc:
+		return r.sized(2, func(n uint64) (interface{}, error) { return r.list(n, depth) })
+	case 0xdd:
+		return r.sized(4, func(n uint64) (interface{}, error) { return r.list(n, depth) })
+	case 0xde:
+		return r.sized(2, func(n uint64) (interface{}, error) { return r.fields(n, depth) })
+	case 0xdf:
+		return r.sized(4, func(n uint64) (interface{}, error) { return r.fields(n, depth) })
+	}
+	return nil, fmt.Errorf("billet/format: invalid MessagePack type 0x%02x", code)
+}
+
+// sized reads a length of the given size and passes it to fn.
+func (r *msgpackReader) sized(size uint64, fn func(n uint64) (interface{}, error)) (interface{}, error) {
+	n, err := r.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	return fn(n)
+}
+
+// Binary values are decoded as strings, since context values never hold
+// byte slices.
+func (r *msgpackReader) str(n uint64) (interface{}, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *msgpackReader) list(n uint64, depth int) (interface{}, error) {
+	list := make([]interface{}, 0, r.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		elem, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, elem)
+	}
+	return list, nil
+}
+
+func (r *msgpackReader) fields(n uint64, depth int) (interface{}, error) {
+	fields := make(Fields, r.capacity(n))
+	for i := uint64(0); i < n; i++ {
+		key, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(string)
+		if !ok {
+			return nil, errors.New("billet/format: MessagePack map key is not a string")
+		}
+		if fields[k], err = r.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// ext reads an extension with a length of the given size.
+func (r *msgpackReader) ext(size uint64) (interface{}, error) {
+	n, err := r.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	return r.extData(n)
+}
+
+// extData reads an extension's type and n bytes of data.  Only timestamps
+// are supported.
+func (r *msgpackReader) extData(n uint64) (interface{}, error) {
+	typ, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != msgpackTimestamp {
+		return nil, fmt.Errorf("billet/format: unsupported MessagePack extension type %d", int8(typ))
+	}
+	switch n {
+	case 4:
+		sec, err := r.uint(4)
+		return time.Unix(int64(sec), 0), err
+	case 8:
+		u, err := r.uint(8)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), err
+	case 12:
+		nsec, err := r.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		sec, err := r.uint(8)
+		return time.Unix(int64(sec), int64(nsec)), err
+	}
+	return nil, fmt.Errorf("billet/format: invalid MessagePack timestamp length %d", n)
+}
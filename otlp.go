@@ -0,0 +1,470 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	otlpDefaultBatchSize     = 100
+	otlpDefaultFlushInterval = time.Second
+	otlpDefaultTraceIdKey    = "trace_id"
+	otlpDefaultSpanIdKey     = "span_id"
+	otlpScopeName            = "billet"
+)
+
+// OTLP sends events to an OpenTelemetry collector as OTLP/HTTP JSON log
+// batches.  Events are converted to LogRecords with the severity number and
+// text, the message as the body, and the context fields as attributes.  The
+// logger name, source location, and error are recorded using the
+// OpenTelemetry semantic conventions.  Context fields named by TraceIdKey
+// and SpanIdKey are sent as the record's trace and span IDs when they hold
+// valid hex IDs.
+//
+// Records are sent once BatchSize records are pending, every FlushInterval,
+// and whenever the logger flushes its collectors.  Batches that fail with a
+// 429 or 5xx status are retried.  Batches rejected with any other status are
+// dropped, and the rejection is reported by the logger's next Flush or
+// Close.  Close sends any pending records and stops the periodic flushes.
+type OTLP struct {
+	// Required
+	Endpoint string // For example, "http://localhost:4318/v1/logs"
+
+	// Optional extras
+	ServiceName   string            // Sent as the service.name resource attribute
+	Resource      Fields            // Additional resource attributes
+	Headers       map[string]string // Extra HTTP headers, such as for authentication
+	Client        *http.Client      // Default: &http.Client{Timeout: 10 * time.Second}
+	BatchSize     int               // Default: 100
+	FlushInterval time.Duration     // Default: 1 second
+	TraceIdKey    string            // Default: "trace_id"
+	SpanIdKey     string            // Default: "span_id"
+}
+
+func (o OTLP) New() Collector {
+	if o.Endpoint == "" {
+		panic("billet/target: OTLP endpoint cannot be empty")
+	}
+	o.setDefaults()
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = otlpDefaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = otlpDefaultFlushInterval
+	}
+
+	c := &otlpCollector{
+		OTLP:      o,
+		formatter: o.Formatter(),
+		resource:  o.renderResource(),
+		done:      make(chan struct{}),
+	}
+	go c.flushPeriodically()
+	return c
+}
+
+func (o *OTLP) setDefaults() {
+	if o.TraceIdKey == "" {
+		o.TraceIdKey = otlpDefaultTraceIdKey
+	}
+	if o.SpanIdKey == "" {
+		o.SpanIdKey = otlpDefaultSpanIdKey
+	}
+}
+
+// Formatter returns a Formatter that renders each event as a single OTLP
+// JSON LogRecord, as it appears within a batch.
+func (o OTLP) Formatter() Formatter {
+	o.setDefaults()
+
+	return func(buffer Buffer, event *Event) {
+		fields := event.Context.Fields()
+
+		record := jsonObject{buffer: buffer}
+		record.begin()
+		record.key("timeUnixNano")
+		buffer.WriteByte('"')
+		buffer.AppendInt(event.Time.UnixNano())
+		buffer.WriteByte('"')
+		record.key("severityNumber")
+		buffer.AppendUint(uint64(otlpSeverityFor(event.Level)))
+		record.key("severityText")
+		writeJSONString(buffer, event.Level.String())
+		record.key("body")
+		writeOTLPValue(buffer, event.Message)
+
+		if id, ok := otlpId(fields, o.TraceIdKey, 32); ok {
+			record.key("traceId")
+			writeJSONString(buffer, id)
+			delete(fields, o.TraceIdKey)
+		}
+		if id, ok := otlpId(fields, o.SpanIdKey, 16); ok {
+			record.key("spanId")
+			writeJSONString(buffer, id)
+			delete(fields, o.SpanIdKey)
+		}
+
+		if name := event.Context.Name(); name != "" {
+			fields["log.logger"] = name
+		}
+		if event.HasFrames() {
+			source := event.Source()
+			fields["code.filepath"] = source.File()
+			fields["code.lineno"] = source.Line()
+			fields["code.function"] = source.Package() + "." + source.Function()
+		}
+		if event.Error != nil {
+			fields["exception.type"] = event.ErrorType()
+			fields["exception.message"] = event.Error.Error()
+		}
+		if len(fields) > 0 {
+			record.key("attributes")
+			writeOTLPAttributes(buffer, fields)
+		}
+		record.end()
+	}
+}
+
+func (o OTLP) renderResource() []byte {
+	attrs := make(Fields)
+	for k, v := range o.Resource {
+		attrs[k] = v
+	}
+	if o.ServiceName != "" {
+		attrs["service.name"] = o.ServiceName
+	}
+	if _, ok := attrs["host.name"]; !ok {
+		if h := host(true); h != "" {
+			attrs["host.name"] = h
+		}
+	}
+
+	buf := NewBufferFrom(nil)
+	resource := jsonObject{buffer: buf}
+	resource.begin()
+	resource.key("attributes")
+	writeOTLPAttributes(buf, attrs)
+	resource.end()
+	return buf.Bytes()
+}
+
+// See the OpenTelemetry log data model's mapping of severity numbers.
+func otlpSeverityFor(level Level) uint {
+	switch level {
+	case DEBUG:
+		return 5
+	case INFO:
+		return 9
+	case WARN:
+		return 13
+	case ERROR:
+		return 17
+	default:
+		return 21
+	}
+}
+
+// otlpId returns the field's value if it's a hex string of the given
+// length.
+func otlpId(fields Fields, key string, length int) (string, bool) {
+	id, ok := fields[key].(string)
+	if !ok || len(id) != length {
+		return "", false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		default:
+			return "", false
+		}
+	}
+	return id, true
+}
+
+func writeOTLPAttributes(buffer Buffer, fields Fields) {
+	sortedKeys := sortedFieldKeys(fields)
+
+	buffer.WriteByte('[')
+	for i, k := range sortedKeys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		attr := jsonObject{buffer: buffer}
+		attr.begin()
+		attr.key("key")
+		writeJSONString(buffer, k)
+		attr.key("value")
+		writeOTLPValue(buffer, fields[k])
+		attr.end()
+	}
+	buffer.WriteByte(']')
+}
+
+// writeOTLPValue writes v as an OTLP AnyValue.  Per the protobuf JSON
+// mapping, 64-bit integers are encoded as strings.
+func writeOTLPValue(buffer Buffer, v interface{}) {
+	value := jsonObject{buffer: buffer}
+	value.begin()
+	switch v := v.(type) {
+	case string:
+		value.key("stringValue")
+		writeJSONString(buffer, v)
+	case bool:
+		value.key("boolValue")
+		buffer.AppendBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		value.key("intValue")
+		buffer.WriteByte('"')
+		buffer.WriteString(fmt.Sprint(v))
+		buffer.WriteByte('"')
+	case ByteSize:
+		value.key("intValue")
+		buffer.WriteByte('"')
+		buffer.AppendUint(uint64(v))
+		buffer.WriteByte('"')
+	case float32:
+		value.key("doubleValue")
+		writeJSONFloat(buffer, float64(v), 32)
+	case float64:
+		value.key("doubleValue")
+		writeJSONFloat(buffer, v, 64)
+	case time.Time:
+		value.key("stringValue")
+		buffer.WriteByte('"')
+		buffer.AppendTime(v, time.RFC3339Nano)
+		buffer.WriteByte('"')
+	case Fields:
+		value.key("kvlistValue")
+		list := jsonObject{buffer: buffer}
+		list.begin()
+		list.key("values")
+		writeOTLPAttributes(buffer, v)
+		list.end()
+	case []interface{}:
+		value.key("arrayValue")
+		array := jsonObject{buffer: buffer}
+		array.begin()
+		array.key("values")
+		buffer.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			writeOTLPValue(buffer, elem)
+		}
+		buffer.WriteByte(']')
+		array.end()
+	case nil:
+	default:
+		value.key("stringValue")
+		writeJSONString(buffer, fmt.Sprint(v))
+	}
+	value.end()
+}
+
+type otlpRecord struct {
+	scope string
+	json  []byte
+}
+
+type otlpCollector struct {
+	OTLP
+	formatter Formatter
+	resource  []byte
+
+	mu       sync.Mutex // Guards pending and rejected
+	pending  []otlpRecord
+	rejected error      // A rejection not yet returned by Flush
+	sending  sync.Mutex // Serializes sends without holding mu
+	done     chan struct{}
+	closed   sync.Once
+}
+
+// otlpRejection is returned when a batch is rejected with a status that
+// can't succeed on retry.  The batch is dropped.
+type otlpRejection struct {
+	status  string
+	records int
+}
+
+func (e otlpRejection) Error() string {
+	return fmt.Sprintf("billet/target: OTLP export rejected with status %s; dropped %d records", e.status, e.records)
+}
+
+func (c *otlpCollector) Collect(event *Event) error {
+	// A failed send leaves a full batch pending.  Retry it before accepting
+	// the event so that the worker's retries don't duplicate the event.
+	if c.numPending() >= c.BatchSize {
+		if err := c.send(); err != nil {
+			return err
+		}
+	}
+
+	record := otlpRecord{
+		scope: event.Context.Name(),
+		json:  Render(c.formatter, event),
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, record)
+	full := len(c.pending) >= c.BatchSize
+	c.mu.Unlock()
+
+	// The event has been accepted, so a failure mustn't make the worker
+	// collect it again.  Failed batches stay pending for a retry.
+	if full {
+		c.send()
+	}
+	return nil
+}
+
+// Flush sends the pending records and returns the send error, or else any
+// rejection since the last Flush.
+func (c *otlpCollector) Flush() error {
+	if err := c.send(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.rejected
+	c.rejected = nil
+	return err
+}
+
+// Close stops the periodic flushes and sends any pending records.
+func (c *otlpCollector) Close() error {
+	c.closed.Do(func() {
+		close(c.done)
+	})
+	return c.Flush()
+}
+
+func (c *otlpCollector) flushPeriodically() {
+	ticker := time.NewTicker(c.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Rejections are kept for the logger's next Flush.
+			c.send()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *otlpCollector) numPending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// send posts the pending records as an ExportLogsServiceRequest, grouping
+// them into scopes by logger name.  Records collected during the request
+// are left pending.  Batches that are rejected are dropped and recorded for
+// Flush, so only errors worth retrying are returned.
+func (c *otlpCollector) send() error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+
+	c.mu.Lock()
+	batch := c.pending[:len(c.pending):len(c.pending)]
+	c.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var scopes []string
+	byScope := make(map[string][]otlpRecord)
+	for _, record := range batch {
+		if _, ok := byScope[record.scope]; !ok {
+			scopes = append(scopes, record.scope)
+		}
+		byScope[record.scope] = append(byScope[record.scope], record)
+	}
+
+	body := NewBuffer()
+	defer ReleaseBuffer(body)
+	body.WriteString(`{"resourceLogs":[{"resource":`)
+	body.Write(c.resource)
+	body.WriteString(`,"scopeLogs":[`)
+	for i, scope := range scopes {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		name := scope
+		if name == "" {
+			name = otlpScopeName
+		}
+		body.WriteString(`{"scope":{"name":`)
+		writeJSONString(body, name)
+		body.WriteString(`},"logRecords":[`)
+		for j, record := range byScope[scope] {
+			if j > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(record.json)
+		}
+		body.WriteString(`]}`)
+	}
+	body.WriteString(`]}]}`)
+
+	request, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		request.Header.Set(k, v)
+	}
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the connection can be reused.
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	status := response.StatusCode
+	if status == http.StatusTooManyRequests || status >= 500 {
+		return fmt.Errorf("billet/target: OTLP export failed with status %s", response.Status)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := copy(c.pending, c.pending[len(batch):])
+	c.pending = c.pending[:n]
+	if status < 200 || status >= 300 {
+		// Other errors won't succeed on retry, so the batch is dropped
+		// rather than blocking the collector forever.
+		c.rejected = errors.Join(c.rejected, otlpRejection{status: response.Status, records: len(batch)})
+	}
+	return nil
+}
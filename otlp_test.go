@@ -0,0 +1,251 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// otlpServer is an OTLP endpoint that responds with the queued statuses, or
+// 200 once they run out, and records the messages in each accepted batch.
+// If gate is set, requests send on it when they arrive and then wait to
+// receive from it before responding.
+type otlpServer struct {
+	*httptest.Server
+	gate chan struct{}
+
+	mu       sync.Mutex
+	statuses []int
+	batches  [][]string
+}
+
+func newOTLPServer(statuses ...int) *otlpServer {
+	s := &otlpServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *otlpServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.gate != nil {
+		s.gate <- struct{}{}
+		<-s.gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					Body struct {
+						StringValue string
+					}
+				}
+			}
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var batch []string
+	for _, resource := range request.ResourceLogs {
+		for _, scope := range resource.ScopeLogs {
+			for _, record := range scope.LogRecords {
+				batch = append(batch, record.Body.StringValue)
+			}
+		}
+	}
+	s.batches = append(s.batches, batch)
+}
+
+func (s *otlpServer) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func newOTLPCollector(t *testing.T, server *otlpServer, batchSize int) *otlpCollector {
+	c := OTLP{
+		Endpoint:      server.URL,
+		BatchSize:     batchSize,
+		FlushInterval: time.Hour,
+	}.New().(*otlpCollector)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func otlpEvent(message string) *Event {
+	return &Event{Time: time.Now(), Level: INFO, Context: EmptyContext, Message: message}
+}
+
+func TestOTLPBatching(t *testing.T) {
+	server := newOTLPServer()
+	defer server.Close()
+	c := newOTLPCollector(t, server, 2)
+
+	for _, message := range []string{"one", "two", "three"} {
+		if err := c.Collect(otlpEvent(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := server.received(); len(got) != 1 || len(got[0]) != 2 || got[0][1] != "two" {
+		t.Fatalf("expected one batch of two records, got %q", got)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); len(got) != 2 || len(got[1]) != 1 || got[1][0] != "three" {
+		t.Errorf("expected the remaining record to be flushed, got %q", got)
+	}
+}
+
+func TestOTLPFlushMarker(t *testing.T) {
+	server := newOTLPServer()
+	defer server.Close()
+	c := newOTLPCollector(t, server, 100)
+
+	l := newLogger()
+	l.collect(INFO, c)
+	l.Info("flushed")
+	if err := l.flush(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); len(got) != 1 || len(got[0]) != 1 || got[0][0] != "flushed" {
+		t.Errorf("expected the logger's flush to send the record, got %q", got)
+	}
+}
+
+func TestOTLPRetry(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		server := newOTLPServer(status)
+		c := newOTLPCollector(t, server, 100)
+
+		c.Collect(otlpEvent("retried"))
+		if err := c.Flush(); err == nil {
+			t.Errorf("%d: expected an error", status)
+		}
+		if err := c.Flush(); err != nil {
+			t.Errorf("%d: %s", status, err)
+		}
+		if got := server.received(); len(got) != 1 || len(got[0]) != 1 || got[0][0] != "retried" {
+			t.Errorf("%d: expected the batch to be retried, got %q", status, got)
+		}
+		server.Close()
+	}
+}
+
+func TestOTLPRejection(t *testing.T) {
+	server := newOTLPServer(http.StatusBadRequest, http.StatusBadRequest)
+	defer server.Close()
+
+	c := newOTLPCollector(t, server, 1)
+	if err := c.Collect(otlpEvent("rejected")); err != nil {
+		t.Fatal(err)
+	}
+	var rejection otlpRejection
+	if err := c.Flush(); !errors.As(err, &rejection) || rejection.records != 1 {
+		t.Errorf("expected Flush to report the rejected batch, got %v", err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Errorf("expected the rejection to be reported once, got %v", err)
+	}
+
+	c.Collect(otlpEvent("rejected"))
+	c.Collect(otlpEvent("accepted"))
+	if err := c.Flush(); err == nil {
+		t.Error("expected Flush to report the rejected batch")
+	}
+	if got := server.received(); len(got) != 1 || got[0][0] != "accepted" {
+		t.Errorf("expected only the later batch to be delivered, got %q", got)
+	}
+}
+
+func TestOTLPCollectDuringSend(t *testing.T) {
+	server := newOTLPServer()
+	server.gate = make(chan struct{})
+	defer server.Close()
+	c := newOTLPCollector(t, server, 100)
+
+	c.Collect(otlpEvent("sent"))
+	flushed := make(chan error)
+	go func() { flushed <- c.Flush() }()
+	<-server.gate
+
+	// Collect mustn't wait for the request that the flush is blocked on.
+	collected := make(chan error)
+	go func() { collected <- c.Collect(otlpEvent("pending")) }()
+	select {
+	case err := <-collected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Collect blocked on an in-flight send")
+	}
+
+	server.gate <- struct{}{}
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if got := server.received(); len(got) != 1 || len(got[0]) != 1 || got[0][0] != "sent" {
+		t.Errorf("expected only the first record to be sent, got %q", got)
+	}
+	if n := c.numPending(); n != 1 {
+		t.Errorf("expected the record collected during the send to stay pending, got %d", n)
+	}
+}
+
+func TestOTLPLoggerClose(t *testing.T) {
+	server := newOTLPServer(http.StatusBadRequest)
+	defer server.Close()
+	c := newOTLPCollector(t, server, 100)
+
+	l := newLogger()
+	l.collect(INFO, c)
+	l.Info("rejected")
+	var rejection otlpRejection
+	if err := l.close(5 * time.Second); !errors.As(err, &rejection) {
+		t.Errorf("expected close to report the rejected batch, got %v", err)
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Error("expected close to stop the periodic flushes")
+	}
+	if len(l.registry) != 0 {
+		t.Error("expected close to remove the collector")
+	}
+}
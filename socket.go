@@ -43,6 +43,7 @@ type socketCollector struct {
 
 func (s *socketCollector) Collect(event *Event) error {
 	buf := NewBuffer()
+	defer ReleaseBuffer(buf)
 	s.Formatter(buf, event)
 
 	time.Sleep(time.Minute)
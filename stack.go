@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+)
+
+// FormatStack renders the event's stack in the style of a Go panic: each
+// frame's qualified function name followed by its file and line on an
+// indented line.  Nothing is written for events without frames.
+func FormatStack(buffer Buffer, event *Event) {
+	for i, frame := range event.Stack() {
+		if i > 0 {
+			buffer.WriteByte('\n')
+		}
+		buffer.WriteString(frame.Package())
+		buffer.WriteByte('.')
+		buffer.WriteString(frame.Function())
+		buffer.WriteString("\n\t")
+		buffer.WriteString(frame.File())
+		buffer.WriteByte(':')
+		buffer.AppendInt(int64(frame.Line()))
+	}
+}
+
+// FormatCompactStack renders the event's stack on a single line, which is
+// suitable for syslog.  Frames are written innermost first, as in
+// "pkg.inner(file.go:12) <- pkg.outer(file.go:30)".
+func FormatCompactStack(buffer Buffer, event *Event) {
+	for i, frame := range event.Stack() {
+		if i > 0 {
+			buffer.WriteString(" <- ")
+		}
+		buffer.WriteString(frame.Package())
+		buffer.WriteByte('.')
+		buffer.WriteString(frame.Function())
+		buffer.WriteByte('(')
+		file := frame.File()
+		if idx := strings.LastIndex(file, "/"); idx != -1 {
+			file = file[idx+1:]
+		}
+		buffer.WriteString(file)
+		buffer.WriteByte(':')
+		buffer.AppendInt(int64(frame.Line()))
+		buffer.WriteByte(')')
+	}
+}
+
+// StackFormatter returns a formatter that applies the given stack formatter,
+// such as FormatStack or FormatCompactStack, only to events at or above the
+// threshold level.  For example, StackFormatter(ERROR, FormatStack) renders
+// stacks for ERROR and FATAL events only.
+func StackFormatter(threshold Level, stackFormatter Formatter) Formatter {
+	return IfLevel(threshold, stackFormatter)
+}
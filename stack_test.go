@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatStack(t *testing.T) {
+	decoded := &Event{Level: ERROR, stack: []*Frame{
+		decodedFrame("example.com/app/db", "(*Pool).Get", "/src/app/db/pool.go", 42),
+		decodedFrame("main", "main", "/src/app/main.go", 7),
+	}}
+	for _, tt := range []struct {
+		name   string
+		format Formatter
+		event  *Event
+		want   string
+	}{
+		{"full", FormatStack, decoded, "example.com/app/db.(*Pool).Get\n\t/src/app/db/pool.go:42\nmain.main\n\t/src/app/main.go:7"},
+		{"compact", FormatCompactStack, decoded, "example.com/app/db.(*Pool).Get(pool.go:42) <- main.main(main.go:7)"},
+		{"full without frames", FormatStack, &Event{Level: ERROR}, ""},
+		{"compact without frames", FormatCompactStack, &Event{Level: ERROR}, ""},
+		{"unknown frame", FormatCompactStack, &Event{Frames: []uintptr{1}}, "???.???(???:0)"},
+		{"below threshold", StackFormatter(ERROR, FormatCompactStack), &Event{Level: WARN, stack: decoded.stack}, ""},
+		{"at threshold", StackFormatter(ERROR, FormatCompactStack), decoded, "example.com/app/db.(*Pool).Get(pool.go:42) <- main.main(main.go:7)"},
+	} {
+		if got := string(Render(tt.format, tt.event)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	captured := &Event{Frames: getFrames(0, maxFrames)}
+	lines := strings.Split(string(Render(FormatStack, captured)), "\n")
+	if len(lines) < 4 || !strings.HasSuffix(lines[0], ".TestFormatStack") || !strings.HasPrefix(lines[1], "\t") || !strings.Contains(lines[1], "stack_test.go:") {
+		t.Errorf("captured stack doesn't start at the test:\n%s", strings.Join(lines, "\n"))
+	}
+	compact := string(Render(FormatCompactStack, captured))
+	if !strings.Contains(compact, ".TestFormatStack(stack_test.go:") || !strings.Contains(compact, " <- testing.tRunner(testing.go:") {
+		t.Errorf("captured compact stack is %q", compact)
+	}
+}
+
+func TestSplitFuncName(t *testing.T) {
+	for _, tt := range []struct {
+		name, pkg, fn string
+	}{
+		{"main.main", "main", "main"},
+		{"github.com/user/pkg.(*T).Method", "github.com/user/pkg", "(*T).Method"},
+		{"github.com/user/pkg.Func.func1", "github.com/user/pkg", "Func.func1"},
+		{"nodot", "???", "nodot"},
+	} {
+		if pkg, fn := splitFuncName(tt.name); pkg != tt.pkg || fn != tt.fn {
+			t.Errorf("splitFuncName(%q) = %q, %q; want %q, %q", tt.name, pkg, fn, tt.pkg, tt.fn)
+		}
+	}
+}
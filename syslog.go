@@ -100,7 +100,8 @@ func (s Syslog) New() Collector {
 	}
 
 	var err error
-	if s.Network == "" || s.Address == "" {
+	local := s.Network == "" || s.Address == ""
+	if local {
 		s.Network, s.Address, err = localSyslog()
 	}
 	if err != nil {
@@ -108,7 +109,7 @@ func (s Syslog) New() Collector {
 	}
 
 	return Socket{
-		Formatter: HumanMessage,
+		Formatter: rfc3164Formatter(s.Facility, s.App, local, s.MessageFormatter),
 		Network:   s.Network,
 		Address:   s.Address,
 	}.New()
@@ -187,16 +188,31 @@ func rfc5424Formatter(facility Facility, app string, msgFormatter Formatter, str
 func rfc5424ContextFormatter(structuredId string, transformer ContextTransformer) Formatter {
 	return func(buf Buffer, e *Event) {
 		buf.WriteString(structuredId)
-		context := e.Context
+		ctx := e.Context
 		if transformer != nil {
-			context = transformer(context)
+			ctx = transformer(ctx)
 		}
-		sub := NewBuffer()
-		formatStructuredContext(sub, context)
-		if sub.Len() > 0 {
-			buf.WriteRune(' ')
-			buf.Write(sub.Bytes())
+		if ctx.NumFields() == 0 {
+			return
+		}
+		// Walk our own contexts directly, as the closure passed to Each
+		// would escape to the heap.
+		if c, ok := ctx.(*context); ok {
+			for current := c.fieldList; current != nil; current = current.parent {
+				writeStructuredPair(buf, current.key, current.value)
+			}
+			return
 		}
+		ctx.Each(func(name string, value interface{}) {
+			writeStructuredPair(buf, name, value)
+		})
+	}
+}
+
+func writeStructuredPair(buf Buffer, name string, value interface{}) {
+	if validStructuredKey(name) {
+		buf.WriteRune(' ')
+		formatStructuredPair(buf, name, value)
 	}
 }
 
@@ -206,12 +222,14 @@ func formatBOM(buf Buffer, event *Event) {
 
 func priFormatter(facility Facility) Formatter {
 	return func(buf Buffer, event *Event) {
-		buf.WriteString(fmt.Sprintf("<%d>", priorityFor(facility, event.Level)))
+		buf.WriteByte('<')
+		buf.AppendUint(uint64(priorityFor(facility, event.Level)))
+		buf.WriteByte('>')
 	}
 }
 
 func procIdFormatter(app string) Formatter {
-	return Literal(fmt.Sprintf("%s[%d]", app, os.Getpid))
+	return Literal(fmt.Sprintf("%s[%d]", app, os.Getpid()))
 }
 
 func priorityFor(facility Facility, level Level) priority {
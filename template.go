@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TemplateKey is the context key holding the raw message template of events
+// logged by the Logger methods, such as Info, so that events can be
+// grouped by template.  It's only added when the template has holes.
+//
+// Templates follow the Serilog syntax.  A hole such as {user} is replaced by
+// the next arg and the arg is added to the context as the "user" field.
+// Numeric holes such as {0} refer to args by index instead.  Prefixing the
+// name with $, as in {$user}, captures the arg as a string, and the @ prefix
+// is accepted and ignored since values are captured with their structure by
+// default.  Use {{ and }} for literal braces.  Holes without a matching arg
+// and malformed holes are rendered as-is, and extra args are ignored.
+const TemplateKey = "template"
+
+// renderTemplate renders the message for template and returns it along with
+// context extended by the captured args.
+func renderTemplate(context Context, template string, args []interface{}) (string, Context) {
+	if strings.IndexAny(template, "{}") == -1 {
+		return template, context
+	}
+
+	buffer := NewBuffer()
+	defer ReleaseBuffer(buffer)
+	next, captured := 0, false
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if (c == '{' || c == '}') && i+1 < len(template) && template[i+1] == c {
+			buffer.WriteByte(c)
+			i++
+			continue
+		}
+		if c != '{' {
+			buffer.WriteByte(c)
+			continue
+		}
+
+		end := strings.IndexByte(template[i:], '}')
+		if end == -1 {
+			buffer.WriteString(template[i:])
+			break
+		}
+		hole := template[i : i+end+1]
+		i += end
+
+		name, stringify, ok := parseHole(hole[1 : len(hole)-1])
+		if !ok {
+			buffer.WriteString(hole)
+			continue
+		}
+		index := next
+		if n, err := strconv.Atoi(name); err == nil {
+			index = n
+		} else {
+			next++
+		}
+		if index >= len(args) {
+			buffer.WriteString(hole)
+			continue
+		}
+
+		arg := args[index]
+		if stringify {
+			arg = fmt.Sprint(arg)
+		}
+		writeTemplateValue(buffer, arg)
+		context = context.WithField(name, arg)
+		captured = true
+	}
+
+	if captured {
+		context = context.WithField(TemplateKey, template)
+	}
+	return string(buffer.Bytes()), context
+}
+
+// parseHole returns the property name of a template hole and whether the
+// value should be captured as a string.  Names consist of letters, digits,
+// and underscores.
+func parseHole(hole string) (name string, stringify bool, ok bool) {
+	switch {
+	case strings.HasPrefix(hole, "$"):
+		hole, stringify = hole[1:], true
+	case strings.HasPrefix(hole, "@"):
+		hole = hole[1:]
+	}
+	if hole == "" {
+		return "", false, false
+	}
+	for i := 0; i < len(hole); i++ {
+		c := hole[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			return "", false, false
+		}
+	}
+	return hole, stringify, true
+}
+
+func writeTemplateValue(buffer Buffer, v interface{}) {
+	if s, ok := v.(string); ok {
+		buffer.WriteString(s)
+		return
+	}
+	buffer.WriteString(fmt.Sprint(v))
+}
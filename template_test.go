@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type templatePoint struct{ X, Y int }
+
+func TestRenderTemplate(t *testing.T) {
+	point := templatePoint{1, 2}
+	for _, tt := range []struct {
+		name     string
+		template string
+		args     []interface{}
+		message  string
+		fields   Fields // Without TemplateKey, which is checked separately
+	}{
+		{"no holes", "plain %d", []interface{}{1}, "plain %d", Fields{}},
+		{"named", "user {user} from {ip}", []interface{}{"bob", "10.0.0.1"},
+			"user bob from 10.0.0.1", Fields{"user": "bob", "ip": "10.0.0.1"}},
+		{"numeric", "{1} then {0} then {1}", []interface{}{"a", "b"},
+			"b then a then b", Fields{"0": "a", "1": "b"}},
+		{"numeric out of range", "{2}", []interface{}{"a"}, "{2}", Fields{}},
+		{"escapes", "{{literal}} {n} }}", []interface{}{3}, "{literal} 3 }", Fields{"n": 3}},
+		{"stringify", "{$point}", []interface{}{point}, "{1 2}", Fields{"point": "{1 2}"}},
+		{"destructure", "{@size}", []interface{}{map[string]int{"w": 3}},
+			"map[w:3]", Fields{"size": Fields{"w": 3}}},
+		{"too few args", "{a} and {b}", []interface{}{1}, "1 and {b}", Fields{"a": 1}},
+		{"too many args", "{a}", []interface{}{1, 2}, "1", Fields{"a": 1}},
+		{"malformed", "{a b} {} {$} {a-b}", []interface{}{1}, "{a b} {} {$} {a-b}", Fields{}},
+		{"unterminated", "{a} {b", []interface{}{1, 2}, "1 {b", Fields{"a": 1}},
+	} {
+		message, context := renderTemplate(EmptyContext, tt.template, tt.args)
+		if message != tt.message {
+			t.Errorf("%s: rendered %q, want %q", tt.name, message, tt.message)
+		}
+
+		fields := context.Fields()
+		template, captured := fields[TemplateKey]
+		delete(fields, TemplateKey)
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: captured %v, want %v", tt.name, fields, tt.fields)
+		}
+		if want := len(tt.fields) > 0; captured != want || captured && template != tt.template {
+			t.Errorf("%s: template field %v, want %v", tt.name, template, want)
+		}
+	}
+}
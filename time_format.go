@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Bob Ziuchkovski
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// processStart approximates when the process started, for FormatElapsed.
+var processStart = time.Now()
+
+// TimeFormatterIn is like TimeFormatter, but renders the event's time in
+// the given location rather than the local time zone.
+func TimeFormatterIn(timeFormat string, loc *time.Location) Formatter {
+	return func(buffer Buffer, event *Event) {
+		buffer.AppendTime(event.Time.In(loc), timeFormat)
+	}
+}
+
+// UTCTimeFormatter is like TimeFormatter, but renders the event's time in
+// UTC.
+func UTCTimeFormatter(timeFormat string) Formatter {
+	return TimeFormatterIn(timeFormat, time.UTC)
+}
+
+// FormatUnix renders the event's time as whole seconds since the Unix epoch.
+func FormatUnix(buffer Buffer, event *Event) {
+	buffer.AppendInt(event.Time.Unix())
+}
+
+// FormatUnixMilli renders the event's time as milliseconds since the Unix
+// epoch.
+func FormatUnixMilli(buffer Buffer, event *Event) {
+	buffer.AppendInt(event.Time.UnixMilli())
+}
+
+// FormatUnixNano renders the event's time as nanoseconds since the Unix
+// epoch.
+func FormatUnixNano(buffer Buffer, event *Event) {
+	buffer.AppendInt(event.Time.UnixNano())
+}
+
+// FormatElapsed renders the time elapsed between process start and the
+// event in seconds, with microsecond precision, such as "12.345678s".
+func FormatElapsed(buffer Buffer, event *Event) {
+	writeSeconds(buffer, event.Time.Sub(processStart))
+}
+
+// DeltaFormatter returns a formatter that renders the time since the
+// previous event rendered by the same formatter, such as "+0.001234s".  The
+// first event renders as "+0.000000s".  This is useful for debugging timing
+// sensitive code, but note that events collected by several collectors are
+// rendered once per collector.
+func DeltaFormatter() Formatter {
+	var last int64
+	return func(buffer Buffer, event *Event) {
+		now := event.Time.UnixNano()
+		prev := atomic.SwapInt64(&last, now)
+		if prev == 0 {
+			prev = now
+		}
+		// writeSeconds writes the sign of negative deltas, which occur when
+		// events are rendered out of order.
+		delta := time.Duration(now - prev)
+		if delta >= 0 {
+			buffer.WriteByte('+')
+		}
+		writeSeconds(buffer, delta)
+	}
+}
+
+func writeSeconds(buffer Buffer, d time.Duration) {
+	if d < 0 {
+		buffer.WriteByte('-')
+		d = -d
+	}
+	micros := int64(d / time.Microsecond)
+	buffer.AppendInt(micros / 1e6)
+	buffer.WriteByte('.')
+	frac := micros % 1e6
+	for div := int64(1e5); div > 0; div /= 10 {
+		buffer.WriteByte(byte('0' + frac/div%10))
+	}
+	buffer.WriteByte('s')
+}
@@ -21,39 +21,101 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"time"
 )
 
 type worker struct {
-	buf chan *Event
+	buf chan workItem
 
 	collector Collector
 }
 
+// workItem is either an event to collect or a flush marker.  Flush markers
+// share the event channel so that they're processed in order: the flushed
+// channel receives the collector's flush error once every previously sent
+// event has been collected.  A closing marker also closes the collector and
+// stops the worker.
+type workItem struct {
+	event   *Event
+	flushed chan error
+	closing bool
+}
+
 func newWorker(c Collector) *worker {
 	w := &worker{
 		collector: c,
-		buf:       make(chan *Event, 100),
+		buf:       make(chan workItem, 100),
 	}
 	go w.run()
 	return w
 }
 
 func (w *worker) send(e *Event) {
-	w.buf <- e
+	w.buf <- workItem{event: e}
 	return
 }
 
+// flush returns a channel that receives the collector's flush error once all
+// events sent prior to the flush call have been collected.
+func (w *worker) flush() <-chan error {
+	return w.mark(false)
+}
+
+// close is like flush, but also closes the collector if it's an io.Closer
+// and stops the worker.  No events may be sent after close.
+func (w *worker) close() <-chan error {
+	return w.mark(true)
+}
+
+func (w *worker) mark(closing bool) <-chan error {
+	flushed := make(chan error, 1)
+	// Queue the marker asynchronously so a full buffer can't block callers
+	// past their own deadlines.
+	go func() {
+		w.buf <- workItem{flushed: flushed, closing: closing}
+	}()
+	return flushed
+}
+
 func (w *worker) run() {
-	var e *Event
+	var item workItem
 	for {
 		select {
-		case e = <-w.buf:
-			w.sendEvent(e)
+		case item = <-w.buf:
+			if item.event != nil {
+				w.sendEvent(item.event)
+				item.event.release()
+			}
+			if item.flushed != nil {
+				err := w.flushCollector()
+				if item.closing {
+					err = errors.Join(err, w.closeCollector())
+				}
+				item.flushed <- err
+				if item.closing {
+					return
+				}
+			}
 		}
 	}
 }
 
+func (w *worker) flushCollector() error {
+	if flusher, ok := w.collector.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+func (w *worker) closeCollector() error {
+	if closer, ok := w.collector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func (w *worker) sendEvent(event *Event) {
 	for {
 		err := w.collector.Collect(event)